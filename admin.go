@@ -0,0 +1,402 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/logging"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// How long an admin request waits for a busy room.
+const adminRoomTimeout = 5 * time.Second
+
+// adminAPI serves the JSON API under /admin, which lets the operators
+// of the server inspect and manage the live rooms:
+//
+//	GET    /admin/rooms               list the rooms
+//	GET    /admin/rooms/{code}        fetch the full state of a room
+//	POST   /admin/rooms/{code}/end    end the game, back to the waiting room
+//	DELETE /admin/rooms/{code}        close the room and disconnect everyone
+//	POST   /admin/rooms/{code}/kick   kick a player, {"playerName": "..."}
+//	POST   /admin/rooms/{code}/ban    ban a player, {"playerName": "...",
+//	                                  "banIp": false}
+//	POST   /admin/notice              send a notice to every room,
+//	                                  {"message": "..."}
+//
+// Every request must have the header "Authorization: Bearer {token}".
+type adminAPI struct {
+	hub   *Hub
+	token string
+}
+
+type adminPlayer struct {
+	Name        string    `json:"name"`
+	IsRoomOwner bool      `json:"isRoomOwner"`
+	IsSpectator bool      `json:"isSpectator"`
+	Connected   bool      `json:"connected"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+type adminFault struct {
+	Error     string    `json:"error"`
+	Stack     string    `json:"stack"`
+	FaultedAt time.Time `json:"faultedAt"`
+}
+
+type adminRoom struct {
+	RoomCode            string        `json:"roomCode"`
+	GameType            string        `json:"gameType"`
+	State               string        `json:"state"`
+	HasPassword         bool          `json:"hasPassword"`
+	Players             []adminPlayer `json:"players"`
+	LastInteractionTime time.Time     `json:"lastInteractionTime"`
+	Fault               *adminFault   `json:"fault,omitempty"`
+}
+
+type adminRoomDetails struct {
+	adminRoom
+	ChatHistory []*models.ChatMessage `json:"chatHistory"`
+	Game        json.RawMessage       `json:"game"`
+}
+
+type adminKickRequest struct {
+	PlayerName string `json:"playerName" validate:"required,max=40"`
+	Reason     string `json:"reason,omitempty" validate:"max=200"`
+}
+
+type adminBanRequest struct {
+	PlayerName string `json:"playerName" validate:"required,max=40"`
+	Reason     string `json:"reason,omitempty" validate:"max=200"`
+	// Whether to also ban the player's IP address, which turns away
+	// everyone else on their network.
+	BanIP bool `json:"banIp,omitempty"`
+}
+
+type adminNoticeRequest struct {
+	Message string `json:"message" validate:"required,max=300"`
+}
+
+func (a *adminAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		adminError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin"), "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "rooms" && r.Method == "GET":
+		a.listRooms(w)
+	case path == "notice" && r.Method == "POST":
+		a.sendNotice(w, r)
+	case len(parts) == 2 && parts[0] == "rooms":
+		switch r.Method {
+		case "GET":
+			a.getRoom(w, parts[1])
+		case "DELETE":
+			a.deleteRoom(w, parts[1])
+		default:
+			adminError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	case len(parts) == 3 && parts[0] == "rooms" && r.Method == "POST":
+		switch parts[2] {
+		case "end":
+			a.endGame(w, parts[1])
+		case "kick":
+			a.kickPlayer(w, r, parts[1])
+		case "ban":
+			a.banPlayer(w, r, parts[1])
+		default:
+			adminError(w, http.StatusNotFound, "Not found")
+		}
+	default:
+		adminError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (a *adminAPI) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return a.token != "" && subtle.ConstantTimeCompare(
+		[]byte(token), []byte(a.token)) == 1
+}
+
+func (a *adminAPI) listRooms(w http.ResponseWriter) {
+	rooms := []adminRoom{}
+	for _, room := range a.hub.getRooms() {
+		room := room
+		var summary adminRoom
+		if inRoom(room, func() {
+			summary = summarizeRoom(room)
+		}) {
+			rooms = append(rooms, summary)
+		}
+	}
+
+	adminReply(w, rooms)
+}
+
+func (a *adminAPI) getRoom(w http.ResponseWriter, roomCode string) {
+	room := a.hub.getRoom(roomCode)
+	if room == nil {
+		adminError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	var details adminRoomDetails
+	var err error
+	if !inRoom(room, func() {
+		details.adminRoom = summarizeRoom(room)
+		details.ChatHistory = room.ChatHistory
+		details.Game, err = room.Game.Snapshot()
+	}) {
+		adminError(w, http.StatusServiceUnavailable, "Room is not responding")
+		return
+	}
+	if err != nil {
+		room.Logger().Error("Could not snapshot room", "error", err)
+		adminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	adminReply(w, details)
+}
+
+func (a *adminAPI) endGame(w http.ResponseWriter, roomCode string) {
+	room := a.hub.getRoom(roomCode)
+	if room == nil {
+		adminError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	room.Logger().Info("Admin ending the game")
+	if !inRoom(room, func() {
+		a.hub.resetRoom(room)
+	}) {
+		adminError(w, http.StatusServiceUnavailable, "Room is not responding")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *adminAPI) deleteRoom(w http.ResponseWriter, roomCode string) {
+	logging.Info("Admin deleting room", "room", roomCode)
+	if !a.hub.deleteRoom(roomCode) {
+		adminError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *adminAPI) kickPlayer(
+	w http.ResponseWriter,
+	r *http.Request,
+	roomCode string,
+) {
+	var req adminKickRequest
+	if !decodeAdminRequest(w, r, &req) {
+		return
+	}
+
+	room := a.hub.getRoom(roomCode)
+	if room == nil {
+		adminError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	room.Logger().Info("Admin kicking player", "player", req.PlayerName,
+		"reason", req.Reason)
+	var err error
+	if !inRoom(room, func() {
+		err = a.hub.removeFromRoom(room, req.PlayerName, api.ErrorKicked,
+			req.Reason)
+	}) {
+		adminError(w, http.StatusServiceUnavailable, "Room is not responding")
+		return
+	}
+	if models.ErrorCodeOf(err) == api.ErrorInvalidRequest {
+		adminError(w, http.StatusNotFound, "Player not found")
+		return
+	}
+	if err != nil {
+		adminError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *adminAPI) banPlayer(
+	w http.ResponseWriter,
+	r *http.Request,
+	roomCode string,
+) {
+	var req adminBanRequest
+	if !decodeAdminRequest(w, r, &req) {
+		return
+	}
+
+	room := a.hub.getRoom(roomCode)
+	if room == nil {
+		adminError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	room.Logger().Info("Admin banning player", "player", req.PlayerName,
+		"reason", req.Reason, "banIp", req.BanIP)
+	var found bool
+	var err error
+	if !inRoom(room, func() {
+		banned := roomMember(room, req.PlayerName)
+		if found = banned != nil; !found {
+			return
+		}
+		if err = checkLeavable(room, banned); err == nil {
+			a.hub.banFromRoom(room, banned, req.Reason, req.BanIP)
+		}
+	}) {
+		adminError(w, http.StatusServiceUnavailable, "Room is not responding")
+		return
+	}
+	if !found {
+		adminError(w, http.StatusNotFound, "Player not found")
+		return
+	}
+	if err != nil {
+		adminError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *adminAPI) sendNotice(w http.ResponseWriter, r *http.Request) {
+	var req adminNoticeRequest
+	if !decodeAdminRequest(w, r, &req) {
+		return
+	}
+
+	logging.Info("Admin notice", "message", req.Message)
+	rooms := a.hub.getRooms()
+	for _, room := range rooms {
+		room := room
+		room.Do(func() {
+			a.hub.sendNotice(room, req.Message)
+		})
+	}
+
+	adminReply(w, map[string]int{"rooms": len(rooms)})
+}
+
+// inRoom runs fn on the room's goroutine and waits for it to finish. It
+// returns false if the room is closed or does not get to fn in time, in
+// which case fn never runs, so the caller can safely report a failure.
+func inRoom(room *models.GameRoom, fn func()) bool {
+	var mutex sync.Mutex
+	cancelled := false
+	done := make(chan struct{})
+	if !room.Do(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if cancelled {
+			return
+		}
+		fn()
+		close(done)
+	}) {
+		return false
+	}
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(adminRoomTimeout):
+	}
+
+	// The room may have got to fn just as the wait ran out, in which
+	// case it is allowed to finish.
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	select {
+	case <-done:
+		return true
+	default:
+		cancelled = true
+		return false
+	}
+}
+
+// This function must be called from the room's goroutine.
+func summarizeRoom(room *models.GameRoom) adminRoom {
+	summary := adminRoom{
+		RoomCode:            room.RoomCode,
+		GameType:            room.GameType,
+		State:               room.Game.State(),
+		HasPassword:         room.Password != nil,
+		Players:             []adminPlayer{},
+		LastInteractionTime: room.LastInteractionTime(),
+	}
+
+	for _, players := range [][]*models.Player{room.Players, room.Spectators} {
+		for _, player := range players {
+			summary.Players = append(summary.Players, adminPlayer{
+				Name:        player.Name,
+				IsRoomOwner: player.IsRoomOwner,
+				IsSpectator: player.IsSpectator,
+				Connected:   player.IsConnected(),
+				LastSeen:    player.LastSeen,
+			})
+		}
+	}
+
+	if room.Fault != nil {
+		summary.Fault = &adminFault{
+			Error:     room.Fault.Error,
+			Stack:     room.Fault.Stack,
+			FaultedAt: room.Fault.FaultedAt,
+		}
+	}
+
+	return summary
+}
+
+func decodeAdminRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	req interface{},
+) bool {
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err == nil {
+		err = api.Validate(req)
+	}
+	if err != nil {
+		adminError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	return true
+}
+
+func adminReply(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func adminError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -2,29 +2,144 @@ package api
 
 type ActionT int
 type EventT int
+type ErrorCodeT int
+
+const (
+	// ProtocolVersion is the newest version of the protocol that the
+	// server speaks. Clients from before version 2 do not say hello,
+	// and need every message in a websocket message of its own.
+	ProtocolVersion = 2
+
+	// MinProtocolVersion is the oldest version that is still accepted.
+	MinProtocolVersion = 1
+)
+
+// Capabilities lists the optional parts of the protocol that the
+// server supports.
+var Capabilities = []string{
+	"bans",
+	"batched-messages",
+	"chat",
+	"error-codes",
+	"lobby",
+	"request-ids",
+	"resume",
+	"spectators",
+	"waitlist",
+}
 
 // IncomingMessage holds any incoming websocket message.
+//
+// RequestID is chosen by the client, and is echoed in the replies to
+// the message so that the client can tell which request they belong to.
 type IncomingMessage struct {
-	Action string      `json:"action"`
-	Body   interface{} `json:"body"`
+	Action    string      `json:"action"`
+	RequestID string      `json:"requestId,omitempty"`
+	Body      interface{} `json:"body"`
+}
+
+// HelloRequest is sent by clients when they connect, with the newest
+// protocol version and the capabilities they support.
+type HelloRequest struct {
+	ProtocolVersion int      `json:"protocolVersion" validate:"min=0"`
+	Capabilities    []string `json:"capabilities" validate:"max=32,dive,max=64"`
 }
 
 // CreateGameRequest is used by clients to create a new game room.
+//
+// Password is optional, and then needed by everyone else who joins.
+// Public rooms are listed in the lobby under their Title. MaxPlayers
+// is optional, and limited by the game.
 type CreateGameRequest struct {
-	GameType string `json:"gameType"`
-	Name     string `json:"name"`
+	GameType   string `json:"gameType" validate:"required,max=32"`
+	Name       string `json:"name" validate:"required,max=40"`
+	Password   string `json:"password,omitempty" validate:"max=64"`
+	Public     bool   `json:"public,omitempty"`
+	Title      string `json:"title,omitempty" validate:"max=60"`
+	MaxPlayers int    `json:"maxPlayers,omitempty" validate:"min=0,max=100"`
 }
 
 // JoinGameRequest is used by clients to officially join a game room.
+//
+// SessionToken is only needed to take back a seat the client already
+// had in the room, along with LastSeq, the sequence number of the last
+// message the client received. Spectators watch the room without taking
+// a seat. Password is needed unless the room has none, or the client
+// takes back its seat with its session token.
 type JoinGameRequest struct {
-	RoomCode string `json:"roomCode"`
-	Name     string `json:"name"`
+	RoomCode     string `json:"roomCode" validate:"required,max=32"`
+	Name         string `json:"name" validate:"required,max=40"`
+	Password     string `json:"password,omitempty" validate:"max=64"`
+	SessionToken string `json:"sessionToken,omitempty" validate:"max=64"`
+	LastSeq      uint64 `json:"lastSeq,omitempty"`
+	Spectator    bool   `json:"spectator,omitempty"`
 }
 
 // KickPlayerRequest is used by the owner of a room to remove a player
-// from the room.
+// from the room. Reason is optional, and shown to the player.
 type KickPlayerRequest struct {
-	PlayerName string `json:"playerName"`
+	PlayerName string `json:"playerName" validate:"required,max=40"`
+	Reason     string `json:"reason,omitempty" validate:"max=200"`
+}
+
+// BanPlayerRequest is used by the owner of a room to remove a player
+// and keep them from joining it again from the same session. BanIP also
+// keeps out everyone on the player's IP address, which is usually their
+// whole home network. Reason is optional, and shown to the player.
+type BanPlayerRequest struct {
+	PlayerName string `json:"playerName" validate:"required,max=40"`
+	Reason     string `json:"reason,omitempty" validate:"max=200"`
+	BanIP      bool   `json:"banIp,omitempty"`
+}
+
+// UnbanPlayerRequest is used by the owner of a room to lift a ban.
+type UnbanPlayerRequest struct {
+	BanID string `json:"banId" validate:"required,max=64"`
+}
+
+// TransferOwnershipRequest is used by the owner of a room to make
+// another player the owner.
+type TransferOwnershipRequest struct {
+	PlayerName string `json:"playerName" validate:"required,max=40"`
+}
+
+// SetPasswordRequest is used by the owner of a room to change the
+// password needed to join it. An empty password removes it.
+type SetPasswordRequest struct {
+	Password string `json:"password" validate:"max=64"`
+}
+
+// SetPublicRequest is used by the owner of a room to list it in the
+// lobby under a title, or to take it off.
+type SetPublicRequest struct {
+	Public bool   `json:"public"`
+	Title  string `json:"title,omitempty" validate:"max=60"`
+}
+
+// SetMaxPlayersRequest is used by the owner of a room to change the
+// most players it lets in. Players beyond it join the waitlist. Zero
+// lets in as many as the game can be played with.
+type SetMaxPlayersRequest struct {
+	MaxPlayers int `json:"maxPlayers" validate:"min=0,max=100"`
+}
+
+// LeaveGameRequest is used by clients to give up their seat, or their
+// place on the waitlist.
+type LeaveGameRequest struct{}
+
+// SubscribeLobbyRequest is used by clients to get the list of public
+// rooms, and every change to it until they unsubscribe or join a room.
+type SubscribeLobbyRequest struct{}
+
+// UnsubscribeLobbyRequest is used by clients to stop getting updates
+// of the lobby.
+type UnsubscribeLobbyRequest struct{}
+
+// SendChatRequest is used by clients to post a message in the room
+// chat, or in their team's chat if Channel is "team".
+type SendChatRequest struct {
+	Channel string `json:"channel" validate:"omitempty,oneof=room team"`
+	Message string `json:"message" validate:"required,max=300"`
 }
 
 // StartGameRequest is used by the owner of a room to start the game.
@@ -35,13 +150,150 @@ type StartGameRequest struct{}
 type RematchRequest struct{}
 
 // OutgoingMessage is any outgoing websockets message.
+//
+// Error is meant to be shown to the player, while ErrorCode is meant
+// for the client to act on. Seq numbers the messages sent to a player
+// in a room, starting from 1.
 type OutgoingMessage struct {
 	Event        string      `json:"event"`
+	Seq          uint64      `json:"seq,omitempty"`
+	RequestID    string      `json:"requestId,omitempty"`
 	Error        string      `json:"error,omitempty"`
+	ErrorCode    string      `json:"errorCode,omitempty"`
 	ErrorIsFatal bool        `json:"errorIsFatal,omitempty"`
 	Body         interface{} `json:"body"`
 }
 
+// WelcomeEvent answers a hello with the protocol version to speak,
+// which can be older than the one the client asked for, and what the
+// server and each game type support.
+type WelcomeEvent struct {
+	ProtocolVersion       int            `json:"protocolVersion"`
+	ServerProtocolVersion int            `json:"serverProtocolVersion"`
+	Capabilities          []string       `json:"capabilities"`
+	Games                 []GameFeatures `json:"games"`
+}
+
+// GameFeatures lists the optional features of a game type.
+type GameFeatures struct {
+	GameType string   `json:"gameType"`
+	Features []string `json:"features"`
+}
+
+// IncompatibleVersionEvent is sent to a client whose protocol version
+// is no longer supported, right before it is disconnected.
+type IncompatibleVersionEvent struct {
+	ProtocolVersion    int `json:"protocolVersion"`
+	MinProtocolVersion int `json:"minProtocolVersion"`
+	MaxProtocolVersion int `json:"maxProtocolVersion"`
+}
+
+// NoticeEvent is a message from the server operators, e.g. about
+// upcoming maintenance, which is sent to everyone in every room.
+type NoticeEvent struct {
+	Message string `json:"message"`
+}
+
+// ServerRestartingEvent is sent to every client right before the
+// server closes its connection to restart. The rooms are kept, so the
+// client can reconnect after about ReconnectAfter milliseconds.
+type ServerRestartingEvent struct {
+	Message        string `json:"message"`
+	ReconnectAfter int64  `json:"reconnectAfter"`
+}
+
+// SessionEvent is sent to a client when it enters a room, with the
+// secret it needs to reconnect as the same player.
+type SessionEvent struct {
+	RoomCode     string `json:"roomCode"`
+	Name         string `json:"name"`
+	SessionToken string `json:"sessionToken"`
+	HasPassword  bool   `json:"hasPassword"`
+}
+
+// LobbyRoom describes a public room in the lobby. MaxPlayers is 0 when
+// the room takes any number of players, and Waiting is the number of
+// players on its waitlist.
+type LobbyRoom struct {
+	RoomCode    string `json:"roomCode"`
+	Title       string `json:"title"`
+	GameType    string `json:"gameType"`
+	Players     int    `json:"players"`
+	MaxPlayers  int    `json:"maxPlayers,omitempty"`
+	Waiting     int    `json:"waiting,omitempty"`
+	State       string `json:"state"`
+	HasPassword bool   `json:"hasPassword"`
+}
+
+// UpdatedLobbyEvent is sent to the clients that subscribed to the lobby
+// with every public room, each time one of them changes.
+type UpdatedLobbyEvent struct {
+	Rooms []LobbyRoom `json:"rooms"`
+}
+
+// UpdatedWaitlistEvent is sent to everyone in a room, and everyone on
+// its waitlist, when the waitlist or the most players the room lets in
+// change. Position is where the client is on the waitlist, starting at
+// 1, or 0 if it is not on it.
+type UpdatedWaitlistEvent struct {
+	Waiting    []string `json:"waiting"`
+	Position   int      `json:"position"`
+	MaxPlayers int      `json:"maxPlayers"`
+}
+
+// Ban is a ban in a room, as shown to its owner. BannedAt is in
+// milliseconds since the epoch.
+type Ban struct {
+	ID         string `json:"id"`
+	PlayerName string `json:"playerName"`
+	Reason     string `json:"reason,omitempty"`
+	BansIP     bool   `json:"bansIp,omitempty"`
+	BannedAt   int64  `json:"bannedAt"`
+}
+
+// UpdatedBansEvent is sent to the owner of a room when they take it
+// over, and when a player is banned from it or unbanned.
+type UpdatedBansEvent struct {
+	Bans []Ban `json:"bans"`
+}
+
+// UpdatedPasswordEvent is sent to everyone in a room when its owner
+// sets or removes the password.
+type UpdatedPasswordEvent struct {
+	HasPassword bool `json:"hasPassword"`
+}
+
+// UpdatedPresenceEvent is sent to everyone in a room when a player
+// connects or disconnects. LastSeen is in milliseconds since the epoch.
+type UpdatedPresenceEvent struct {
+	PlayerName string `json:"playerName"`
+	Connected  bool   `json:"connected"`
+	LastSeen   int64  `json:"lastSeen"`
+}
+
+// ResumedEvent is sent to a client that rejoins a room after the
+// message numbered LastSeq. Unless FullResync is set, it is followed by
+// the messages it missed; otherwise it is sent the full state instead.
+type ResumedEvent struct {
+	LastSeq    uint64 `json:"lastSeq"`
+	FullResync bool   `json:"fullResync"`
+}
+
+// ChatEvent is sent to everyone who can read a chat message. SentAt is
+// in milliseconds since the epoch.
+type ChatEvent struct {
+	Channel    string `json:"channel"`
+	PlayerName string `json:"playerName"`
+	Message    string `json:"message"`
+	SentAt     int64  `json:"sentAt"`
+}
+
+// ChatHistoryEvent is sent to a client when it enters a room, with the
+// recent chat messages it can read, oldest first.
+type ChatHistoryEvent struct {
+	Messages []ChatEvent `json:"messages"`
+}
+
 // UpdatedGameEvent
 type UpdatedGameEvent struct{}
 
@@ -53,6 +305,17 @@ const (
 	ActionKickPlayer
 	ActionStartGame
 	ActionRematch
+	ActionTransferOwnership
+	ActionSendChat
+	ActionHello
+	ActionSetPassword
+	ActionSetPublic
+	ActionSubscribeLobby
+	ActionUnsubscribeLobby
+	ActionSetMaxPlayers
+	ActionLeaveGame
+	ActionBanPlayer
+	ActionUnbanPlayer
 )
 
 const (
@@ -61,17 +324,95 @@ const (
 	EventCreatedGame
 	EventUpdatedRoom
 	EventUpdatedGame
+	EventSession
+	EventUpdatedPresence
+	EventChat
+	EventChatHistory
+	EventResumed
+	EventWelcome
+	EventIncompatibleVersion
+	EventNotice
+	EventServerRestarting
+	EventUpdatedPassword
+	EventUpdatedLobby
+	EventUpdatedWaitlist
+	EventUpdatedBans
+)
+
+const (
+	// Error codes
+	ErrorUnknown ErrorCodeT = iota
+	ErrorBadRequest
+	ErrorInvalidAction
+	ErrorInvalidRequest
+	ErrorInvalidGameType
+	ErrorInvalidState
+	ErrorRoomNotFound
+	ErrorNotInRoom
+	ErrorNotRoomOwner
+	ErrorNotYourTurn
+	ErrorNameTaken
+	ErrorSessionInvalid
+	ErrorRoomFull
+	ErrorForbidden
+	ErrorRateLimited
+	ErrorTooManyRooms
+	ErrorIncompatibleVersion
+	ErrorRoomFaulted
+	ErrorNoRoomCodes
+	ErrorWrongPassword
+	ErrorPasswordLocked
+	ErrorKicked
+	ErrorBanned
 )
 
 var (
 	// Action holds a map of action types to protocol string.
 	Action = map[ActionT]string{
-		ActionInvalid:    "invalid action",
-		ActionCreateGame: "create-game",
-		ActionJoinGame:   "join-game",
-		ActionKickPlayer: "kick-player",
-		ActionStartGame:  "start-game",
-		ActionRematch:    "rematch",
+		ActionInvalid:           "invalid action",
+		ActionCreateGame:        "create-game",
+		ActionJoinGame:          "join-game",
+		ActionKickPlayer:        "kick-player",
+		ActionStartGame:         "start-game",
+		ActionRematch:           "rematch",
+		ActionTransferOwnership: "transfer-ownership",
+		ActionSendChat:          "send-chat",
+		ActionHello:             "hello",
+		ActionSetPassword:       "set-password",
+		ActionSetPublic:         "set-public",
+		ActionSubscribeLobby:    "subscribe-lobby",
+		ActionUnsubscribeLobby:  "unsubscribe-lobby",
+		ActionSetMaxPlayers:     "set-max-players",
+		ActionLeaveGame:         "leave-game",
+		ActionBanPlayer:         "ban-player",
+		ActionUnbanPlayer:       "unban-player",
+	}
+
+	// ErrorCode holds a map of error codes to protocol string.
+	ErrorCode = map[ErrorCodeT]string{
+		ErrorUnknown:             "unknown",
+		ErrorBadRequest:          "bad-request",
+		ErrorInvalidAction:       "invalid-action",
+		ErrorInvalidRequest:      "invalid-request",
+		ErrorInvalidGameType:     "invalid-game-type",
+		ErrorInvalidState:        "invalid-state",
+		ErrorRoomNotFound:        "room-not-found",
+		ErrorNotInRoom:           "not-in-room",
+		ErrorNotRoomOwner:        "not-room-owner",
+		ErrorNotYourTurn:         "not-your-turn",
+		ErrorNameTaken:           "name-taken",
+		ErrorSessionInvalid:      "session-invalid",
+		ErrorRoomFull:            "room-full",
+		ErrorForbidden:           "forbidden",
+		ErrorRateLimited:         "rate-limited",
+		ErrorTooManyRooms:        "too-many-rooms",
+		ErrorIncompatibleVersion: "incompatible-version",
+		ErrorRoomFaulted:         "room-faulted",
+		ErrorNoRoomCodes:         "no-room-codes",
+		ErrorWrongPassword:       "wrong-password",
+		ErrorPasswordLocked:      "password-locked",
+		ErrorKicked:              "kicked",
+		ErrorBanned:              "banned",
 	}
 
 	// ActionLookup holds a reverse map of Action.
@@ -79,10 +420,23 @@ var (
 
 	// Event holds a map of event types to protocol string.
 	Event = map[EventT]string{
-		EventInvalid:     "invalid event",
-		EventCreatedGame: "created-game",
-		EventUpdatedRoom: "updated-room",
-		EventUpdatedGame: "updated-game",
+		EventInvalid:             "invalid event",
+		EventCreatedGame:         "created-game",
+		EventUpdatedRoom:         "updated-room",
+		EventUpdatedGame:         "updated-game",
+		EventSession:             "session",
+		EventUpdatedPresence:     "updated-presence",
+		EventChat:                "chat",
+		EventChatHistory:         "chat-history",
+		EventResumed:             "resumed",
+		EventWelcome:             "welcome",
+		EventIncompatibleVersion: "incompatible-version",
+		EventNotice:              "notice",
+		EventServerRestarting:    "server-restarting",
+		EventUpdatedPassword:     "updated-password",
+		EventUpdatedLobby:        "updated-lobby",
+		EventUpdatedWaitlist:     "updated-waitlist",
+		EventUpdatedBans:         "updated-bans",
 	}
 )
 
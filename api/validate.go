@@ -0,0 +1,236 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Requests declare their constraints with a validate tag on each field,
+// which holds a comma-separated list of rules:
+//
+//	required   the field must be set; strings must not be blank
+//	omitempty  skip the other rules if the field is not set
+//	min=N      numbers must be at least N, strings and lists must have
+//	           at least N characters or items
+//	max=N      like min, but at most N
+//	oneof=A B  the field must be one of the space-separated values
+//	enum=NAME  the field must be one of the values of an enumeration
+//	           registered with RegisterEnum
+//	dive       the rules after it apply to each item of a list, or each
+//	           value of a map
+//
+// Nested structs are validated as well.
+
+// FieldError describes why one field of a request is invalid. Field is
+// the path to it in the JSON body, e.g. "settings.rounds[1]".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the invalid fields of a request. It is sent as
+// the body of the error event.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return "That request is invalid."
+	}
+	return e.Fields[0].Message
+}
+
+var enums = make(map[string]func(string) bool)
+
+// RegisterEnum makes an enumeration available to the enum rule, where
+// isValid reports whether a value belongs to it. It must be called on
+// program startup.
+func RegisterEnum(name string, isValid func(string) bool) {
+	enums[name] = isValid
+}
+
+// Validate checks a request against the validate tags of its fields,
+// and returns a *ValidationError if any of them fail.
+func Validate(req interface{}) error {
+	v := reflect.ValueOf(req)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	var e ValidationError
+	validateStruct(v, "", &e)
+	if len(e.Fields) > 0 {
+		return &e
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, path string, e *ValidationError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		if path != "" {
+			name = path + "." + name
+		}
+
+		var rules []string
+		if tag := field.Tag.Get("validate"); tag != "" {
+			rules = strings.Split(tag, ",")
+		}
+		validateValue(v.Field(i), name, rules, e)
+	}
+}
+
+func validateValue(
+	v reflect.Value,
+	path string,
+	rules []string,
+	e *ValidationError,
+) {
+	for idx, rule := range rules {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+
+		if name == "omitempty" {
+			if isEmpty(v) {
+				return
+			}
+			continue
+		}
+
+		if name == "dive" {
+			if v.Kind() == reflect.Map {
+				for _, key := range v.MapKeys() {
+					validateValue(v.MapIndex(key),
+						fmt.Sprintf("%s.%v", path, key.Interface()),
+						rules[idx+1:], e)
+				}
+				return
+			}
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				panic(fmt.Sprintf("dive on %s, which is not a list", path))
+			}
+			for i := 0; i < v.Len(); i++ {
+				validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i),
+					rules[idx+1:], e)
+			}
+			return
+		}
+
+		if msg := checkRule(v, name, param); msg != "" {
+			e.Fields = append(e.Fields, FieldError{
+				Field:   path,
+				Rule:    name,
+				Message: fmt.Sprintf("The %s field %s.", path, msg),
+			})
+			// The other rules would most likely fail for the same reason.
+			return
+		}
+	}
+
+	if v.Kind() == reflect.Struct {
+		validateStruct(v, path, e)
+	}
+}
+
+// checkRule returns why the value breaks the rule, or "" if it does not.
+func checkRule(v reflect.Value, rule string, param string) string {
+	switch rule {
+	case "required":
+		if isEmpty(v) {
+			return "is required"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid %s rule: %s", rule, param))
+		}
+
+		size, unit := sizeOf(v)
+		if rule == "min" && size < float64(limit) {
+			if unit == "" {
+				return fmt.Sprintf("must be at least %d", limit)
+			}
+			return fmt.Sprintf("must have at least %d %s", limit, unit)
+		}
+		if rule == "max" && size > float64(limit) {
+			if unit == "" {
+				return fmt.Sprintf("must be at most %d", limit)
+			}
+			return fmt.Sprintf("cannot have more than %d %s", limit, unit)
+		}
+	case "oneof":
+		value := fmt.Sprint(v.Interface())
+		for _, allowed := range strings.Fields(param) {
+			if value == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of: %s",
+			strings.Join(strings.Fields(param), ", "))
+	case "enum":
+		isValid, ok := enums[param]
+		if !ok {
+			panic(fmt.Sprintf("unknown enumeration: %s", param))
+		}
+		if !isValid(fmt.Sprint(v.Interface())) {
+			return "is not a valid value"
+		}
+	default:
+		panic(fmt.Sprintf("unknown validation rule: %s", rule))
+	}
+
+	return ""
+}
+
+// sizeOf returns the number of a number, characters of a string or
+// items of a list, along with what it counts.
+func sizeOf(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "items"
+	}
+
+	panic(fmt.Sprintf("cannot measure a %s", v.Kind()))
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return v.IsZero()
+}
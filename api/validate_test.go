@@ -0,0 +1,201 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testSettings struct {
+	Rounds []int `json:"rounds" validate:"max=3,dive,min=1,max=60"`
+}
+
+type testRequest struct {
+	Name     string         `json:"name" validate:"required,max=8"`
+	Password string         `json:"password" validate:"omitempty,min=4"`
+	Color    string         `json:"color" validate:"oneof=red blue"`
+	Shape    string         `json:"shape" validate:"enum=testShape"`
+	Count    int            `json:"count" validate:"min=2,max=10"`
+	Words    []string       `json:"words" validate:"dive,required"`
+	Limits   map[string]int `json:"limits" validate:"dive,min=0"`
+	Settings testSettings   `json:"settings"`
+
+	// Unexported fields are not validated.
+	internal string `validate:"required"`
+}
+
+func init() {
+	RegisterEnum("testShape", func(s string) bool {
+		return s == "circle" || s == "square"
+	})
+}
+
+func validTestRequest() testRequest {
+	return testRequest{
+		Name:  "Ada",
+		Color: "red",
+		Shape: "circle",
+		Count: 2,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *testRequest)
+		// The field and rule of each expected error, e.g.
+		// "name required".
+		want []string
+	}{
+		{
+			name:   "valid",
+			modify: func(r *testRequest) {},
+		},
+		{
+			name:   "required",
+			modify: func(r *testRequest) { r.Name = "" },
+			want:   []string{"name required"},
+		},
+		{
+			name:   "required and blank",
+			modify: func(r *testRequest) { r.Name = "   " },
+			want:   []string{"name required"},
+		},
+		{
+			name:   "max characters",
+			modify: func(r *testRequest) { r.Name = "Ada Lovelace" },
+			want:   []string{"name max"},
+		},
+		{
+			name:   "max counts characters, not bytes",
+			modify: func(r *testRequest) { r.Name = "éééééééé" },
+		},
+		{
+			name:   "omitempty skips an empty field",
+			modify: func(r *testRequest) { r.Password = "" },
+		},
+		{
+			name:   "omitempty checks a set field",
+			modify: func(r *testRequest) { r.Password = "abc" },
+			want:   []string{"password min"},
+		},
+		{
+			name:   "oneof",
+			modify: func(r *testRequest) { r.Color = "green" },
+			want:   []string{"color oneof"},
+		},
+		{
+			name:   "enum",
+			modify: func(r *testRequest) { r.Shape = "triangle" },
+			want:   []string{"shape enum"},
+		},
+		{
+			name:   "min number",
+			modify: func(r *testRequest) { r.Count = 1 },
+			want:   []string{"count min"},
+		},
+		{
+			name:   "max number",
+			modify: func(r *testRequest) { r.Count = 11 },
+			want:   []string{"count max"},
+		},
+		{
+			name:   "dive into a list",
+			modify: func(r *testRequest) { r.Words = []string{"a", "", "c"} },
+			want:   []string{"words[1] required"},
+		},
+		{
+			name:   "dive into a map",
+			modify: func(r *testRequest) { r.Limits = map[string]int{"chat": -1} },
+			want:   []string{"limits.chat min"},
+		},
+		{
+			name: "nested struct",
+			modify: func(r *testRequest) {
+				r.Settings.Rounds = []int{30, 0, 90}
+			},
+			want: []string{"settings.rounds[1] min", "settings.rounds[2] max"},
+		},
+		{
+			name: "rules before dive apply to the list",
+			modify: func(r *testRequest) {
+				r.Settings.Rounds = []int{1, 2, 3, 4}
+			},
+			want: []string{"settings.rounds max"},
+		},
+		{
+			name: "several fields",
+			modify: func(r *testRequest) {
+				r.Name = ""
+				r.Count = 0
+			},
+			want: []string{"name required", "count min"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := validTestRequest()
+			test.modify(&req)
+
+			var got []string
+			if err := Validate(&req); err != nil {
+				verr, ok := err.(*ValidationError)
+				if !ok {
+					t.Fatalf("Validate() = %T, want *ValidationError", err)
+				}
+				for _, field := range verr.Fields {
+					got = append(got, field.Field+" "+field.Rule)
+				}
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Validate() failed on %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateMessage(t *testing.T) {
+	tests := []struct {
+		modify func(r *testRequest)
+		want   string
+	}{
+		{
+			modify: func(r *testRequest) { r.Name = "" },
+			want:   "The name field is required.",
+		},
+		{
+			modify: func(r *testRequest) { r.Name = "Ada Lovelace" },
+			want:   "The name field cannot have more than 8 characters.",
+		},
+		{
+			modify: func(r *testRequest) { r.Count = 1 },
+			want:   "The count field must be at least 2.",
+		},
+		{
+			modify: func(r *testRequest) { r.Color = "green" },
+			want:   "The color field must be one of: red, blue.",
+		},
+	}
+
+	for _, test := range tests {
+		req := validTestRequest()
+		test.modify(&req)
+
+		err := Validate(&req)
+		if err == nil {
+			t.Errorf("Validate() = nil, want %q", test.want)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("Validate() = %q, want %q", err.Error(), test.want)
+		}
+	}
+}
+
+func TestValidateNil(t *testing.T) {
+	var req *testRequest
+	if err := Validate(req); err != nil {
+		t.Errorf("Validate(nil) = %v, want nil", err)
+	}
+}
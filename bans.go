@@ -0,0 +1,216 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/models"
+	"github.com/sndurkin/game-night-in/util"
+)
+
+// This function must be called from the room's goroutine.
+func (h *Hub) banPlayer(player *models.Player, req api.BanPlayerRequest) {
+	player.Logger().Info("Ban player request", "banned", req.PlayerName,
+		"reason", req.Reason)
+
+	room, err := h.performRoomChecks(player, true, false)
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	banned := roomMember(room, req.PlayerName)
+	if banned == nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That player is not in the game.",
+			Code:   api.ErrorInvalidRequest,
+		})
+		return
+	}
+	if banned == player {
+		err = models.NewError(api.ErrorInvalidRequest, "You cannot ban yourself.")
+	} else {
+		err = checkLeavable(room, banned)
+	}
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	h.banFromRoom(room, banned, req.Reason, req.BanIP)
+}
+
+// banFromRoom bans a player from a room, by their session, and removes
+// them from it. The ban also matches their IP address if banIP is set,
+// which turns away everyone else on their network too.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) banFromRoom(
+	room *models.GameRoom,
+	banned *models.Player,
+	reason string,
+	banIP bool,
+) {
+	ban := &models.RoomBan{
+		ID:           util.GenerateToken(),
+		PlayerName:   banned.Name,
+		Reason:       strings.TrimSpace(reason),
+		SessionToken: banned.SessionToken,
+		BannedAt:     time.Now(),
+	}
+	if client, ok := banned.Client.(*Client); ok && banIP {
+		ban.IP = client.ip
+	}
+	room.Bans = append(room.Bans, ban)
+	room.Logger().Info("Banned player", "player", ban.PlayerName,
+		"ip", ban.IP, "ban", ban.ID)
+
+	h.removeFromRoom(room, banned.Name, api.ErrorBanned, ban.Reason)
+	h.sendBans(room)
+}
+
+// This function must be called from the room's goroutine.
+func (h *Hub) unbanPlayer(player *models.Player, req api.UnbanPlayerRequest) {
+	player.Logger().Info("Unban player request", "ban", req.BanID)
+
+	room, err := h.performRoomChecks(player, true, false)
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	for idx, ban := range room.Bans {
+		if ban.ID == req.BanID {
+			room.Bans = append(room.Bans[:idx], room.Bans[idx+1:]...)
+			room.Logger().Info("Unbanned player", "player", ban.PlayerName,
+				"ban", ban.ID)
+			h.sendBans(room)
+			return
+		}
+	}
+
+	h.sendErrorMessage(&models.ErrorMessageRequest{
+		Player: player,
+		Error:  "That ban does not exist.",
+		Code:   api.ErrorInvalidRequest,
+	})
+}
+
+// rejectIfBanned lets a client know, and returns true, if it comes from
+// an IP address or session that is banned from the room.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) rejectIfBanned(
+	room *models.GameRoom,
+	client *Client,
+	player *models.Player,
+	sessionToken string,
+	fatal bool,
+) bool {
+	for _, ban := range room.Bans {
+		if !ban.Matches(client.ip, sessionToken) {
+			continue
+		}
+
+		room.Logger().Info("Turned away banned client", "ip", client.ip,
+			"player", player.Name, "ban", ban.ID)
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Fatal:  fatal,
+			Error:  removedMessage(api.ErrorBanned, ban.Reason),
+			Code:   api.ErrorBanned,
+		})
+		return true
+	}
+	return false
+}
+
+// sendBans sends the bans of the room to its owner. The IP addresses
+// and session tokens they match are never sent.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) sendBans(room *models.GameRoom) {
+	var owner *models.Player
+	for _, player := range room.Players {
+		if player.IsRoomOwner {
+			owner = player
+			break
+		}
+	}
+	if owner == nil {
+		return
+	}
+
+	bans := make([]api.Ban, 0, len(room.Bans))
+	for _, ban := range room.Bans {
+		bans = append(bans, api.Ban{
+			ID:         ban.ID,
+			PlayerName: ban.PlayerName,
+			Reason:     ban.Reason,
+			BansIP:     ban.IP != "",
+			BannedAt:   ban.BannedAt.UnixNano() / 1000000,
+		})
+	}
+
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventUpdatedBans]
+	msg.Body = api.UpdatedBansEvent{
+		Bans: bans,
+	}
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		PrimaryClient: owner.Client,
+		PrimaryMsg:    &msg,
+		Room:          room,
+	})
+}
+
+// disconnectRemoved sends a player who was removed from a room a fatal
+// error saying why, and closes their connection once it is sent.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) disconnectRemoved(
+	player *models.Player,
+	code api.ErrorCodeT,
+	reason string,
+) {
+	client, ok := player.Client.(*Client)
+	if !ok {
+		return
+	}
+
+	h.sendErrorMessage(&models.ErrorMessageRequest{
+		Player: player,
+		Fatal:  true,
+		Error:  removedMessage(code, reason),
+		Code:   code,
+	})
+	h.unbindClient(client)
+	client.closeSend()
+}
+
+// removedMessage returns the error shown to a player who was kicked or
+// banned from a room, with the reason the owner gave, if any.
+func removedMessage(code api.ErrorCodeT, reason string) string {
+	message := "You were removed from this game."
+	if code == api.ErrorBanned {
+		message = "You were banned from this game."
+	}
+	if reason = strings.TrimSpace(reason); reason != "" {
+		message += " Reason: " + reason
+	}
+	return message
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sndurkin/game-night-in/api"
+)
+
+func TestBanPlayer(t *testing.T) {
+	const (
+		householdIP = "203.0.113.5"
+		otherIP     = "198.51.100.9"
+	)
+	banned := []string{api.ErrorCode[api.ErrorBanned]}
+
+	tests := []struct {
+		name  string
+		banIP bool
+		// Who joins after Bob is banned, from where, and whether they
+		// present Bob's session token.
+		joinName     string
+		joinIP       string
+		withBobToken bool
+		wantSeated   bool
+		wantCodes    []string
+	}{
+		{
+			name:         "Bob comes back",
+			joinName:     "Bob",
+			joinIP:       householdIP,
+			withBobToken: true,
+			wantCodes:    banned,
+		},
+		{
+			name:         "Bob comes back under another name",
+			joinName:     "Robert",
+			joinIP:       otherIP,
+			withBobToken: true,
+			wantCodes:    banned,
+		},
+		{
+			name:       "someone else in Bob's household",
+			joinName:   "Dan",
+			joinIP:     householdIP,
+			wantSeated: true,
+		},
+		{
+			name:       "someone else in Bob's household, after a network ban",
+			banIP:      true,
+			joinName:   "Dan",
+			joinIP:     householdIP,
+			wantCodes:  banned,
+			wantSeated: false,
+		},
+		{
+			name:       "someone elsewhere, after a network ban",
+			banIP:      true,
+			joinName:   "Dan",
+			joinIP:     otherIP,
+			wantSeated: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newTestHub()
+			ada := newTestClient(t, h, "192.0.2.1")
+			room := createTestRoom(t, h, ada, api.CreateGameRequest{
+				GameType: "fishbowl",
+				Name:     "Ada",
+			})
+			joinTestRoom(t, h, newTestClient(t, h, householdIP), room,
+				api.JoinGameRequest{Name: "Bob"})
+			joinTestRoom(t, h, newTestClient(t, h, householdIP), room,
+				api.JoinGameRequest{Name: "Cy"})
+
+			var bobToken string
+			inTestRoom(t, room, func() {
+				bob, _ := h.getPlayerInRoom(room, "Bob")
+				bobToken = bob.SessionToken
+			})
+
+			sendTestMessage(t, h, ada, room, "ban-player",
+				api.BanPlayerRequest{PlayerName: "Bob", BanIP: test.banIP})
+			inTestRoom(t, room, func() {
+				if bob, _ := h.getPlayerInRoom(room, "Bob"); bob != nil {
+					t.Error("Bob is still seated after being banned")
+				}
+				if cy, _ := h.getPlayerInRoom(room, "Cy"); cy == nil {
+					t.Error("Cy lost their seat when Bob was banned")
+				}
+				if len(room.Bans) != 1 {
+					t.Fatalf("room has %d bans, want 1", len(room.Bans))
+				}
+				if bansIP := room.Bans[0].IP != ""; bansIP != test.banIP {
+					t.Errorf("ban matches the IP address = %v, want %v",
+						bansIP, test.banIP)
+				}
+			})
+
+			req := api.JoinGameRequest{Name: test.joinName}
+			if test.withBobToken {
+				req.SessionToken = bobToken
+			}
+			client := newTestClient(t, h, test.joinIP)
+			joinTestRoom(t, h, client, room, req)
+
+			inTestRoom(t, room, func() {
+				player, _ := h.getPlayerInRoom(room, test.joinName)
+				if seated := player != nil; seated != test.wantSeated {
+					t.Errorf("%s seated = %v, want %v", test.joinName,
+						seated, test.wantSeated)
+				}
+			})
+			if codes := takeErrorCodes(t, client); !reflect.DeepEqual(codes,
+				test.wantCodes) {
+				t.Errorf("%s was sent errors %v, want %v", test.joinName,
+					codes, test.wantCodes)
+			}
+		})
+	}
+}
+
+func TestRemovePlayerChecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		byOwner  bool
+		action   string
+		body     interface{}
+		wantCode api.ErrorCodeT
+	}{
+		{
+			name:     "owner kicks themselves",
+			byOwner:  true,
+			action:   "kick-player",
+			body:     api.KickPlayerRequest{PlayerName: "Ada"},
+			wantCode: api.ErrorInvalidRequest,
+		},
+		{
+			name:     "owner bans themselves",
+			byOwner:  true,
+			action:   "ban-player",
+			body:     api.BanPlayerRequest{PlayerName: "Ada"},
+			wantCode: api.ErrorInvalidRequest,
+		},
+		{
+			name:     "owner kicks nobody",
+			byOwner:  true,
+			action:   "kick-player",
+			body:     api.KickPlayerRequest{PlayerName: "Zed"},
+			wantCode: api.ErrorInvalidRequest,
+		},
+		{
+			name:     "player kicks someone",
+			action:   "kick-player",
+			body:     api.KickPlayerRequest{PlayerName: "Ada"},
+			wantCode: api.ErrorNotRoomOwner,
+		},
+		{
+			name:     "player bans someone",
+			action:   "ban-player",
+			body:     api.BanPlayerRequest{PlayerName: "Ada"},
+			wantCode: api.ErrorNotRoomOwner,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newTestHub()
+			ada := newTestClient(t, h, "192.0.2.1")
+			room := createTestRoom(t, h, ada, api.CreateGameRequest{
+				GameType: "fishbowl",
+				Name:     "Ada",
+			})
+			bob := newTestClient(t, h, "192.0.2.2")
+			joinTestRoom(t, h, bob, room, api.JoinGameRequest{Name: "Bob"})
+
+			sender := bob
+			if test.byOwner {
+				sender = ada
+			}
+			takeMessages(t, sender)
+			sendTestMessage(t, h, sender, room, test.action, test.body)
+
+			want := []string{api.ErrorCode[test.wantCode]}
+			if codes := takeErrorCodes(t, sender); !reflect.DeepEqual(codes,
+				want) {
+				t.Errorf("sender was sent errors %v, want %v", codes, want)
+			}
+			inTestRoom(t, room, func() {
+				if len(room.Players) != 2 {
+					t.Errorf("room has %d players, want 2", len(room.Players))
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// sendChat posts a chat message in the room of the player and sends it
+// to everyone who can read it.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) sendChat(player *models.Player, req api.SendChatRequest) {
+	room, err := h.performRoomChecks(player, false, false)
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	text := strings.TrimSpace(req.Message)
+	msg := &models.ChatMessage{
+		Channel:    req.Channel,
+		Team:       -1,
+		PlayerName: player.Name,
+		Text:       text,
+		SentAt:     time.Now(),
+	}
+	if msg.Channel == "" {
+		msg.Channel = models.ChatChannelRoom
+	}
+
+	switch msg.Channel {
+	case models.ChatChannelRoom:
+	case models.ChatChannelTeam:
+		if !player.IsSpectator {
+			msg.Team = room.Game.PlayerTeam(player)
+		}
+		if msg.Team < 0 {
+			h.sendErrorMessage(&models.ErrorMessageRequest{
+				Player: player,
+				Error:  "You are not on a team.",
+				Code:   api.ErrorInvalidRequest,
+			})
+			return
+		}
+		for _, p := range room.Players {
+			if room.Game.PlayerTeam(p) == msg.Team {
+				msg.Readers = append(msg.Readers, p.Name)
+			}
+		}
+	default:
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That is not a valid chat channel.",
+			Code:   api.ErrorInvalidRequest,
+		})
+		return
+	}
+
+	if err := room.Game.CheckChat(player, msg.Channel); err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	player.Logger().Info("Chat message", "channel", msg.Channel)
+	room.AddChatMessage(msg)
+
+	var outgoingMsg api.OutgoingMessage
+	outgoingMsg.Event = api.Event[api.EventChat]
+	outgoingMsg.Body = convertChatMessageToAPIChatEvent(msg)
+	for _, players := range [][]*models.Player{room.Players, room.Spectators} {
+		for _, p := range players {
+			if p.Client == nil || !room.CanSeeChatMessage(p, msg) {
+				continue
+			}
+
+			h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+				PrimaryClient: p.Client,
+				PrimaryMsg:    &outgoingMsg,
+				Room:          room,
+			})
+		}
+	}
+}
+
+// sendChatHistory sends a player who just entered the room the chat
+// messages they can read.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) sendChatHistory(room *models.GameRoom, player *models.Player) {
+	messages := make([]api.ChatEvent, 0, len(room.ChatHistory))
+	for _, msg := range room.ChatHistory {
+		if room.CanSeeChatMessage(player, msg) {
+			messages = append(messages, convertChatMessageToAPIChatEvent(msg))
+		}
+	}
+
+	if len(messages) == 0 {
+		return
+	}
+
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventChatHistory]
+	msg.Body = api.ChatHistoryEvent{
+		Messages: messages,
+	}
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		PrimaryClient: player.Client,
+		PrimaryMsg:    &msg,
+		Room:          room,
+	})
+}
+
+func convertChatMessageToAPIChatEvent(msg *models.ChatMessage) api.ChatEvent {
+	return api.ChatEvent{
+		Channel:    msg.Channel,
+		PlayerName: msg.PlayerName,
+		Message:    msg.Text,
+		SentAt:     msg.SentAt.UnixNano() / 1000000,
+	}
+}
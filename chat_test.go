@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sndurkin/game-night-in/api"
+	fishbowl_api "github.com/sndurkin/game-night-in/fishbowl/api"
+)
+
+func TestTeamChatVisibility(t *testing.T) {
+	h := newTestHub()
+	clients := map[string]*Client{
+		"Ada": newTestClient(t, h, "192.0.2.1"),
+		"Bob": newTestClient(t, h, "192.0.2.2"),
+		"Cy":  newTestClient(t, h, "192.0.2.3"),
+		"Eve": newTestClient(t, h, "192.0.2.4"),
+	}
+	room := createTestRoom(t, h, clients["Ada"], api.CreateGameRequest{
+		GameType: "fishbowl",
+		Name:     "Ada",
+	})
+	joinTestRoom(t, h, clients["Bob"], room, api.JoinGameRequest{Name: "Bob"})
+	joinTestRoom(t, h, clients["Cy"], room, api.JoinGameRequest{Name: "Cy"})
+	joinTestRoom(t, h, clients["Eve"], room,
+		api.JoinGameRequest{Name: "Eve", Spectator: true})
+
+	move := func(name string, from int, to int) {
+		sendTestMessage(t, h, clients["Ada"], room, "move-player",
+			fishbowl_api.MovePlayerRequest{
+				PlayerName: name,
+				FromTeam:   from,
+				ToTeam:     to,
+			})
+	}
+	chat := func(name string, channel string, text string) {
+		sendTestMessage(t, h, clients[name], room, "send-chat",
+			api.SendChatRequest{Channel: channel, Message: text})
+	}
+
+	// Everyone starts on the first team.
+	move("Cy", 0, 1)
+	chat("Bob", "team", "before Cy came over")
+	move("Cy", 1, 0)
+	chat("Cy", "team", "after Cy came over")
+	move("Bob", 0, 1)
+	chat("Bob", "team", "after Bob left")
+	chat("Ada", "room", "hello everyone")
+	for name, client := range clients {
+		if codes := takeErrorCodes(t, client); len(codes) > 0 {
+			t.Fatalf("%s was sent errors %v", name, codes)
+		}
+	}
+
+	tests := []struct {
+		reader string
+		want   []string
+	}{
+		{
+			reader: "Ada",
+			want: []string{
+				"before Cy came over",
+				"after Cy came over",
+				"hello everyone",
+			},
+		},
+		{
+			reader: "Bob",
+			want: []string{
+				"before Cy came over",
+				"after Cy came over",
+				"after Bob left",
+				"hello everyone",
+			},
+		},
+		{
+			reader: "Cy",
+			want: []string{
+				"after Cy came over",
+				"hello everyone",
+			},
+		},
+		{
+			reader: "Eve",
+			want:   []string{"hello everyone"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.reader, func(t *testing.T) {
+			inTestRoom(t, room, func() {
+				reader := roomMember(room, test.reader)
+				got := []string{}
+				for _, msg := range room.ChatHistory {
+					if room.CanSeeChatMessage(reader, msg) {
+						got = append(got, msg.Text)
+					}
+				}
+				if !reflect.DeepEqual(got, test.want) {
+					t.Errorf("%s can read %q, want %q", test.reader, got,
+						test.want)
+				}
+			})
+		})
+	}
+}
@@ -2,25 +2,16 @@ package main
 
 import (
 	"bytes"
-	"log"
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
-)
-
-const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
-
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/logging"
+	"github.com/sndurkin/game-night-in/models"
 )
 
 var (
@@ -40,12 +31,75 @@ type Client struct {
 	// The websocket connection.
 	conn *websocket.Conn
 
-	// Buffered channel of outbound messages.
-	send chan []byte
+	// Outbound messages, which are pushed by the hub and by every room
+	// goroutine that the client's player belongs to.
+	send *outbox
+
+	// Requested room, player name & session token, and the sequence
+	// number of the last message received before reconnecting
+	roomCode     string
+	playerName   string
+	sessionToken string
+	lastSeq      uint64
+
+	// IP address the connection came from.
+	ip string
+
+	// Throttles incoming messages. It is only used by readPump, along
+	// with throttled, which is set once the client has been told to
+	// slow down.
+	limiter   *clientRateLimiter
+	throttled bool
+
+	// Protocol version agreed with the client, or 0 if it has not said
+	// which one it speaks. It is read by writePump, so it is only ever
+	// accessed atomically.
+	protocolVersion int32
+
+	// Room that incoming game actions are routed to. This is guarded
+	// by the hub mutex.
+	room *models.GameRoom
+}
+
+// trySend queues a message to the client without blocking. If the
+// client has stopped reading, its connection is closed and false is
+// returned.
+func (c *Client) trySend(message []byte) bool {
+	err := c.send.push(message)
+	if err == errSlowClient {
+		logging.Warn("Disconnecting slow client", "ip", c.ip)
+		slowClientDrops.Inc()
+	}
+
+	return err == nil
+}
 
-	// Requested room & player name
-	roomCode   string
-	playerName string
+// declaredProtocolVersion returns the protocol version agreed with the
+// client, or 0 if it has not said which one it speaks.
+func (c *Client) declaredProtocolVersion() int {
+	return int(atomic.LoadInt32(&c.protocolVersion))
+}
+
+func (c *Client) setProtocolVersion(version int) {
+	atomic.StoreInt32(&c.protocolVersion, int32(version))
+}
+
+// isClosed returns whether the client's connection has gone away.
+func (c *Client) isClosed() bool {
+	return c.send.isClosed()
+}
+
+// closeSend closes the outbox, which makes writePump close the
+// connection once the waiting messages are written. It is safe to call
+// more than once.
+func (c *Client) closeSend() {
+	c.send.close()
+}
+
+// closeSendWith closes the outbox like closeSend, and makes writePump
+// close the connection with the given close code and reason.
+func (c *Client) closeSendWith(code int, text string) {
+	c.send.closeWith(websocket.FormatCloseMessage(code, text))
 }
 
 // ClientMessage represents a single message from a client.
@@ -62,20 +116,29 @@ type ClientMessage struct {
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
+		c.hub.connections.release(c.ip)
+		connectionsGauge.Dec()
 		c.conn.Close()
+
+		// Nothing more can be sent either, so let writePump finish.
+		c.closeSend()
 	}()
-	c.conn.SetReadLimit(maxMessageSize)
+	pongWait := c.hub.cfg.Connections.PongWait.Duration
+	c.conn.SetReadLimit(int64(c.hub.cfg.Connections.MaxMessageSize))
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+				logging.Warn("Unexpected close", "ip", c.ip, "error", err)
 			}
 			break
 		}
 		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
+		if !c.allowMessage(message) {
+			continue
+		}
 		c.hub.message <- &ClientMessage{
 			client:  c,
 			message: message,
@@ -83,41 +146,73 @@ func (c *Client) readPump() {
 	}
 }
 
+// allowMessage checks the message against the client's rate limits.
+// Every throttled request with an ID gets an error, so that the client
+// is not left waiting for a reply, and so does the first one without.
+func (c *Client) allowMessage(message []byte) bool {
+	// Malformed messages are still counted, and the hub reports them.
+	var incomingMessage struct {
+		Action    string `json:"action"`
+		RequestID string `json:"requestId"`
+	}
+	json.Unmarshal(message, &incomingMessage)
+
+	if c.limiter.allow(incomingMessage.Action) {
+		c.throttled = false
+		return true
+	}
+
+	if !c.throttled {
+		c.throttled = true
+		logging.Info("Throttling client", "ip", c.ip,
+			"action", incomingMessage.Action)
+	} else if incomingMessage.RequestID == "" {
+		// The client has already been told to slow down.
+		return false
+	}
+
+	output, err := json.Marshal(api.OutgoingMessage{
+		Event:     "error",
+		RequestID: incomingMessage.RequestID,
+		Error:     "You are sending too many requests, please slow down.",
+		ErrorCode: api.ErrorCode[api.ErrorRateLimited],
+	})
+	if err == nil {
+		c.trySend(output)
+	}
+	return false
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 //
 // A goroutine running writePump is started for each connection. The
 // application ensures that there is at most one writer to a connection by
 // executing all writes from this goroutine.
 func (c *Client) writePump() {
+	// Send pings to the peer a little more often than it has to answer
+	// them.
+	pingPeriod := (c.hub.cfg.Connections.PongWait.Duration * 9) / 10
+	writeWait := c.hub.cfg.Connections.WriteWait.Duration
+
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.removeLiveClient(c)
+		c.hub.writers.Done()
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case <-c.send.ready:
+			messages, closed := c.send.take()
+			if err := c.writeMessages(messages); err != nil {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued chat messages to the current websocket message.
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(newline)
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			if closed {
+				c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+				c.conn.WriteMessage(websocket.CloseMessage,
+					c.send.finalPayload())
 				return
 			}
 		case <-ticker.C:
@@ -129,22 +224,76 @@ func (c *Client) writePump() {
 	}
 }
 
+// writeMessages writes messages to the websocket connection, all in
+// one websocket message unless the client is too old to split them up
+// again.
+func (c *Client) writeMessages(messages [][]byte) error {
+	batched := c.declaredProtocolVersion() >= batchedMessagesProtocolVersion
+	for len(messages) > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(
+			c.hub.cfg.Connections.WriteWait.Duration))
+		w, err := c.conn.NextWriter(websocket.TextMessage)
+		if err != nil {
+			return err
+		}
+
+		w.Write(messages[0])
+		messages = messages[1:]
+		for batched && len(messages) > 0 {
+			w.Write(newline)
+			w.Write(messages[0])
+			messages = messages[1:]
+		}
+
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // serveWs handles websocket requests from the peer.
 func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	ip := hub.proxies.clientIP(r)
+	if !hub.connections.acquire(ip) {
+		logging.Warn("Too many connections", "ip", ip)
+		http.Error(w, "Too many connections", http.StatusTooManyRequests)
+		return
+	}
+
+	if !hub.trackWriter() {
+		hub.connections.release(ip)
+		http.Error(w, "Server restarting", http.StatusServiceUnavailable)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		logging.Warn("Could not upgrade connection", "ip", ip, "error", err)
+		hub.connections.release(ip)
+		hub.writers.Done()
 		return
 	}
+	connectionsGauge.Inc()
+
 	client := &Client{
-		hub:  hub,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:     hub,
+		conn:    conn,
+		send:    newOutbox(hub.cfg.Connections),
+		ip:      ip,
+		limiter: newClientRateLimiter(hub.cfg.RateLimits),
 
-		playerName: r.URL.Query().Get("name"),
-		roomCode:   r.URL.Query().Get("roomCode"),
+		playerName:   r.URL.Query().Get("name"),
+		roomCode:     r.URL.Query().Get("roomCode"),
+		sessionToken: r.URL.Query().Get("sessionToken"),
+	}
+	client.lastSeq, _ = strconv.ParseUint(r.URL.Query().Get("lastSeq"), 10, 64)
+	if version, err := strconv.Atoi(r.URL.Query().Get("protocolVersion")); err == nil {
+		// Checked by the hub when the client is registered.
+		client.protocolVersion = int32(version)
 	}
 
+	hub.addLiveClient(client)
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/config"
+)
+
+func TestAllowMessage(t *testing.T) {
+	api.Init()
+	cfg := config.Default()
+	cfg.RateLimits = config.RateLimitConfig{
+		Connection:    config.RateLimit{Rate: 0, Burst: 100},
+		DefaultAction: config.RateLimit{Rate: 0, Burst: 1},
+	}
+	h := newHub(cfg, nil)
+
+	type message struct {
+		data        string
+		wantAllowed bool
+		// Request ID of the error the client is sent, or "-" if it is
+		// not sent one.
+		wantError string
+	}
+
+	tests := []struct {
+		name     string
+		messages []message
+	}{
+		{
+			name: "every throttled request gets an error",
+			messages: []message{
+				{`{"action":"start-game","requestId":"1"}`, true, "-"},
+				{`{"action":"start-game","requestId":"2"}`, false, "2"},
+				{`{"action":"start-game","requestId":"3"}`, false, "3"},
+			},
+		},
+		{
+			name: "only the first message without an ID gets an error",
+			messages: []message{
+				{`{"action":"start-game"}`, true, "-"},
+				{`{"action":"start-game"}`, false, ""},
+				{`{"action":"start-game"}`, false, "-"},
+				{`{"action":"start-game","requestId":"4"}`, false, "4"},
+			},
+		},
+		{
+			name: "throttling ends",
+			messages: []message{
+				{`{"action":"start-game"}`, true, "-"},
+				{`{"action":"start-game"}`, false, ""},
+				{`{"action":"rematch"}`, true, "-"},
+				{`{"action":"rematch"}`, false, ""},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(t, h, "203.0.113.1")
+			for i, msg := range test.messages {
+				if allowed := c.allowMessage([]byte(msg.data)); allowed != msg.wantAllowed {
+					t.Errorf("message %d: allowMessage() = %v, want %v", i,
+						allowed, msg.wantAllowed)
+				}
+
+				sent := takeMessages(t, c)
+				switch {
+				case msg.wantError == "-" && len(sent) != 0:
+					t.Errorf("message %d: sent %d messages, want none", i,
+						len(sent))
+				case msg.wantError != "-" && len(sent) != 1:
+					t.Errorf("message %d: sent %d messages, want an error", i,
+						len(sent))
+				case msg.wantError != "-" && (sent[0].ErrorCode !=
+					api.ErrorCode[api.ErrorRateLimited] ||
+					sent[0].RequestID != msg.wantError):
+					t.Errorf("message %d: sent %+v, want a rate-limited "+
+						"error for request %q", i, sent[0], msg.wantError)
+				}
+			}
+		})
+	}
+}
@@ -8,12 +8,14 @@ type PlayerT int
 type Player struct {
 	Name        string `json:"name"`
 	IsRoomOwner bool   `json:"isRoomOwner,omitempty"`
+	Connected   bool   `json:"connected"`
 }
 
-// Team holds the information about a specific team.
+// Team holds the information about a specific team. It is sent to
+// everyone, so the cards of the team are only sent to its spymaster,
+// as SpymasterCardIndices.
 type Team struct {
-	Players     []*Player `json:"players"`
-	CardIndices []int     `json:"cardIndices"`
+	Players []*Player `json:"players"`
 }
 
 // GameSettings holds all the relevant information about a game's
@@ -21,15 +23,15 @@ type Team struct {
 type GameSettings struct {
 	SingleGuesser bool `json:"singleGuesser"`
 	UseTimer      bool `json:"useTimer"`
-	TimerLength   int  `json:"timerLength"`
+	TimerLength   int  `json:"timerLength" validate:"min=0,max=600"`
 }
 
 // MovePlayerRequest is used by the owner of a room to move a player
 // from one team to another.
 type MovePlayerRequest struct {
-	PlayerName   string  `json:"playerName"`
-	ToTeam       int     `json:"toTeam"`
-	ToPlayerType PlayerT `json:"toPlayerType"`
+	PlayerName   string  `json:"playerName" validate:"required,max=40"`
+	ToTeam       int     `json:"toTeam" validate:"min=0,max=1"`
+	ToPlayerType PlayerT `json:"toPlayerType" validate:"min=0,max=1"`
 }
 
 // ChangeSettingsRequest is used by the owner of a room to change
@@ -40,13 +42,13 @@ type ChangeSettingsRequest struct {
 
 // StartTurnRequest is used by the current player to start their turn.
 type StartTurnRequest struct {
-	NumCards int `json:"numCards"`
+	NumCards int `json:"numCards" validate:"min=0,max=25"`
 }
 
 // EndTurnRequest is used by the current team to
 // guess the cards and end the turn.
 type EndTurnRequest struct {
-	CardGuessIndices []int `json:"cardGuessIndices"`
+	CardGuessIndices []int `json:"cardGuessIndices" validate:"max=25,dive,min=0,max=24"`
 }
 
 // CreatedGameEvent is an event that is sent to a player
@@ -62,17 +64,19 @@ type CreatedGameEvent struct {
 // in a room whenever a change has been made to it (e.g. player joining,
 // player switching teams, etc).
 type UpdatedRoomEvent struct {
-	GameType string       `json:"gameType"`
-	Teams    []Team       `json:"teams"`
-	Settings GameSettings `json:"settings"`
+	GameType   string       `json:"gameType"`
+	Teams      []Team       `json:"teams"`
+	Spectators []string     `json:"spectators"`
+	Settings   GameSettings `json:"settings"`
 }
 
 // UpdatedGameEvent is an event that is sent to all players
 // playing a game whenever a change has been made to its state.
 type UpdatedGameEvent struct {
-	GameType string       `json:"gameType,omitempty"`
-	Teams    []Team       `json:"teams,omitempty"`
-	Settings GameSettings `json:"settings,omitempty"`
+	GameType   string       `json:"gameType,omitempty"`
+	Teams      []Team       `json:"teams,omitempty"`
+	Spectators []string     `json:"spectators,omitempty"`
+	Settings   GameSettings `json:"settings,omitempty"`
 
 	State                string   `json:"state"`
 	CurrentlyPlayingTeam int      `json:"currentlyPlayingTeam"`
@@ -2,23 +2,22 @@ package codenames
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"os"
 	"strings"
-	"sync"
 	"time"
 
 	api "github.com/sndurkin/game-night-in/api"
 	codenames_api "github.com/sndurkin/game-night-in/codenames/api"
+	"github.com/sndurkin/game-night-in/config"
+	"github.com/sndurkin/game-night-in/logging"
 	"github.com/sndurkin/game-night-in/models"
 	"github.com/sndurkin/game-night-in/util"
 )
 
 // Game holds the game-specific data and logic.
 type Game struct {
-	mutex                *sync.RWMutex
 	sendOutgoingMessages models.OutgoingMessageRequestFn
 	sendErrorMessage     models.ErrorMessageRequestFn
 	room                 *models.GameRoom
@@ -26,6 +25,7 @@ type Game struct {
 
 	state             string
 	gameJustStarted   bool
+	playersChanged    bool
 	turnJustStarted   bool
 	currentServerTime int64
 	timer             *time.Timer
@@ -72,25 +72,75 @@ var (
 	allCards []string
 )
 
+func init() {
+	actions := make([]string, 0, len(codenames_api.Action))
+	for actionType, action := range codenames_api.Action {
+		if actionType != codenames_api.ActionInvalid {
+			actions = append(actions, action)
+		}
+	}
+
+	models.RegisterGame(&models.GameDefinition{
+		GameType:    "codenames",
+		DisplayName: "Codenames",
+		Description: "Spymasters give one-word clues to lead their team " +
+			"to its agents while avoiding the assassin.",
+		MinPlayers: 4,
+		MaxPlayers: 4,
+		DefaultSettings: func() interface{} {
+			return convertSettingsToAPISettings(&gameSettings{})
+		},
+		Actions:  actions,
+		Features: []string{"turn-timer", "single-guesser"},
+		Init:     Init,
+		NewGame: func(
+			gameRoom *models.GameRoom,
+			sendOutgoingMessages models.OutgoingMessageRequestFn,
+			sendErrorMessage models.ErrorMessageRequestFn,
+		) models.Game {
+			return NewGame(gameRoom, sendOutgoingMessages, sendErrorMessage)
+		},
+	})
+}
+
 // Init is called on program startup.
-func Init() {
+func Init(cfg *config.Config) {
 	codenames_api.Init()
 
-	content, err := ioutil.ReadFile("./codenames/codenames-words.txt")
-	if err != nil {
-		log.Fatal(err)
+	// The same word can be in more than one list, but must only be
+	// on the board once.
+	allCards = nil
+	seen := make(map[string]bool)
+	for _, path := range cfg.Codenames.WordLists {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			logging.Error("Could not read the word list", "path", path,
+				"error", err)
+			os.Exit(1)
+		}
+
+		for _, word := range strings.Split(string(content), "\n") {
+			word = strings.TrimSpace(word)
+			if word != "" && !seen[word] {
+				seen[word] = true
+				allCards = append(allCards, word)
+			}
+		}
+	}
+
+	if len(allCards) < 25 {
+		logging.Error("The word lists need at least 25 different words",
+			"words", len(allCards))
+		os.Exit(1)
 	}
-	allCards = strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n")
 }
 
 func NewGame(
 	gameRoom *models.GameRoom,
-	mutex *sync.RWMutex,
 	sendOutgoingMessages models.OutgoingMessageRequestFn,
 	sendErrorMessage models.ErrorMessageRequestFn,
 ) *Game {
 	g := &Game{
-		mutex:                mutex,
 		sendOutgoingMessages: sendOutgoingMessages,
 		sendErrorMessage:     sendErrorMessage,
 		settings:             &gameSettings{},
@@ -164,36 +214,57 @@ func (g *Game) HandleIncomingMessage(
 ) {
 	actionType, ok := codenames_api.ActionLookup[incomingMessage.Action]
 	if !ok {
-		log.Fatalf("invalid codenames action: %s\n", incomingMessage.Action)
+		player.Logger().Info("Invalid action",
+			"gameAction", incomingMessage.Action)
+		g.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That is not a valid action.",
+			Code:   api.ErrorInvalidAction,
+		})
+		return
 	}
 
 	switch actionType {
 	case codenames_api.ActionMovePlayer:
 		var req codenames_api.MovePlayerRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Fatal(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.movePlayer(player, req)
 	case codenames_api.ActionChangeSettings:
 		var req codenames_api.ChangeSettingsRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Fatal(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.changeSettings(player, req)
 	case codenames_api.ActionStartTurn:
 		var req codenames_api.StartTurnRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Fatal(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.startTurn(player, req)
 	case codenames_api.ActionEndTurn:
 		var req codenames_api.EndTurnRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Fatal(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.endTurn(player, req)
 	default:
-		log.Fatalf("could not handle incoming action %s", incomingMessage.Action)
+		player.Logger().Warn("Could not handle incoming action",
+			"gameAction", incomingMessage.Action)
+		g.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That is not a valid action.",
+			Code:   api.ErrorInvalidAction,
+		})
 	}
 }
 
@@ -207,29 +278,24 @@ func (g *Game) movePlayer(
 	} else {
 		roleName = "guesser"
 	}
-	log.Printf("Move player request: %s to %d (%s)\n", req.PlayerName,
-		req.ToTeam, roleName)
-
-	var msg api.OutgoingMessage
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Move player request", "moved", req.PlayerName,
+		"toTeam", req.ToTeam, "role", roleName)
 
 	_, err := g.performRoomChecks(player, true, false, false)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
 
 	if req.ToTeam < 0 || req.ToTeam >= len(g.teams) {
-		msg.Event = "error"
-		msg.Error = "The team indexes are invalid."
-		g.sendOutgoingMessages(&models.OutgoingMessageRequest{
-			PrimaryClient: player.Client,
-			PrimaryMsg:    &msg,
+		g.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "The team indexes are invalid.",
+			Code:   api.ErrorInvalidRequest,
 		})
 		return
 	}
@@ -255,16 +321,14 @@ func (g *Game) changeSettings(
 	player *models.Player,
 	req codenames_api.ChangeSettingsRequest,
 ) {
-	log.Printf("Change settings request\n")
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Change settings request")
 
 	_, err := g.performRoomChecks(player, true, false, false)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -277,16 +341,14 @@ func (g *Game) startTurn(
 	player *models.Player,
 	req codenames_api.StartTurnRequest,
 ) {
-	log.Printf("Start turn request\n")
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Start turn request")
 
 	_, err := g.performRoomChecks(player, false, true, false)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -295,6 +357,7 @@ func (g *Game) startTurn(
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot perform that action at this time.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
@@ -311,16 +374,14 @@ func (g *Game) endTurn(
 	player *models.Player,
 	req codenames_api.EndTurnRequest,
 ) {
-	log.Printf("End turn request\n")
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("End turn request")
 
 	_, err := g.performRoomChecks(player, false, false, true)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -329,6 +390,7 @@ func (g *Game) endTurn(
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot perform that action at this time.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
@@ -338,6 +400,7 @@ func (g *Game) endTurn(
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot make that many guesses.",
+			Code:   api.ErrorInvalidRequest,
 		})
 		return
 	}
@@ -348,6 +411,7 @@ func (g *Game) endTurn(
 				Player: player,
 				Error: fmt.Sprintf("Card \"%s\" has already been guessed.",
 					g.cards[cardGuessIdx]),
+				Code: api.ErrorInvalidRequest,
 			})
 			return
 		}
@@ -374,7 +438,7 @@ func (g *Game) endTurn(
 
 // AddPlayer adds a player to the current game.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) AddPlayer(player *models.Player) {
 	g.teams[0].players[codenames_api.PlayerSpymaster] = player
 
@@ -390,6 +454,7 @@ func (g *Game) AddPlayer(player *models.Player) {
 	g.sendOutgoingMessages(&models.OutgoingMessageRequest{
 		PrimaryClient: player.Client,
 		PrimaryMsg:    &msg,
+		Room:          g.room,
 	})
 }
 
@@ -400,7 +465,8 @@ func (g *Game) Join(
 ) {
 	if !newPlayerJoined {
 		// Only the player's connection was updated, a new player has not joined.
-		log.Printf("Sending game message because new player has not joined\n")
+		player.Logger().Debug(
+			"Sending game message because new player has not joined")
 		g.sendUpdatedGameMessages(player.Client)
 		return
 	}
@@ -409,6 +475,7 @@ func (g *Game) Join(
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot join a game that has already started.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
@@ -430,6 +497,7 @@ loops:
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "This game is full.",
+			Code:   api.ErrorRoomFull,
 		})
 		return
 	}
@@ -444,15 +512,28 @@ loops:
 
 // Start starts the game.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) Start(player *models.Player) {
 	if !g.validateStateTransition(g.state, "turn-start") {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot perform that action at this time.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
+	for _, team := range g.teams {
+		for _, p := range team.players {
+			if p == nil {
+				g.sendErrorMessage(&models.ErrorMessageRequest{
+					Player: player,
+					Error:  "Every seat must be taken to start the game.",
+					Code:   api.ErrorInvalidState,
+				})
+				return
+			}
+		}
+	}
 	g.state = "turn-start"
 	g.gameJustStarted = true
 
@@ -465,21 +546,96 @@ func (g *Game) Start(player *models.Player) {
 
 // Kick removes a player from the game.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) Kick(playerName string) {
-	// TODO
+	playerToKick := g.removePlayerFromTeam(g.room, -1, playerName)
+	if playerToKick != nil {
+		playerToKick.Room = nil
+		playerToKick.IsRoomOwner = false
+	}
 
 	g.sendUpdatedGameMessages(nil)
 }
 
+// UpdatePlayers sends the teams to every player in the room.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) UpdatePlayers() {
+	g.playersChanged = true
+	g.sendUpdatedGameMessages(nil)
+	g.playersChanged = false
+}
+
+// PlayerTeam returns the index of the player's team, or -1.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) PlayerTeam(player *models.Player) int {
+	for teamIdx, team := range g.teams {
+		for _, p := range team.players {
+			if p == player {
+				return teamIdx
+			}
+		}
+	}
+
+	return -1
+}
+
+// State returns the current state of the game.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) State() string {
+	return g.state
+}
+
+// PlayerLimits returns the number of seats, which must all be taken.
+func (g *Game) PlayerLimits() (int, int) {
+	seats := 0
+	for _, team := range g.teams {
+		seats += len(team.players)
+	}
+	return seats, seats
+}
+
+// Stop stops the turn timer, so that it does not fire on a game that
+// has been thrown away.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) Stop() {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+}
+
+// CheckChat keeps spymasters out of their team's chat while a turn is
+// in progress, since they could give away more than their clue.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) CheckChat(player *models.Player, channel string) error {
+	if channel != models.ChatChannelTeam || g.state != "turn-active" {
+		return nil
+	}
+
+	for _, team := range g.teams {
+		if team.players[codenames_api.PlayerSpymaster] == player {
+			return models.NewError(api.ErrorForbidden,
+				"Spymasters cannot use the team chat during a turn.")
+		}
+	}
+
+	return nil
+}
+
 // Rematch starts a new game with the same players and settings.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) Rematch(player *models.Player) {
 	if !g.validateStateTransition(g.state, "waiting-room") {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot perform that action at this time.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
@@ -488,11 +644,11 @@ func (g *Game) Rematch(player *models.Player) {
 	g.cardIndicesGuessed = []int{}
 	g.winningTeam = nil
 
-	log.Println("Sending out updated game messages for rematch")
+	g.room.Logger().Debug("Sending out updated game messages for rematch")
 	g.sendUpdatedGameMessages(nil)
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) removePlayerFromTeam(
 	room *models.GameRoom,
 	fromTeamIdx int,
@@ -511,31 +667,32 @@ func (g *Game) removePlayerFromTeam(
 	return nil
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) getCurrentSpymaster(room *models.GameRoom) *models.Player {
 	team := g.teams[g.currentlyPlayingTeam]
 	return team.players[codenames_api.PlayerSpymaster]
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) getCurrentGuesser(room *models.GameRoom) *models.Player {
 	team := g.teams[g.currentlyPlayingTeam]
 	return team.players[codenames_api.PlayerGuesser]
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 	room := g.room
 	if g.state == "waiting-room" {
 		var msg api.OutgoingMessage
 		msg.Event = api.Event[api.EventUpdatedRoom]
 		msg.Body = codenames_api.UpdatedRoomEvent{
-			GameType: room.GameType,
-			Teams:    convertTeamsToAPITeams(g.teams),
-			Settings: convertSettingsToAPISettings(g.settings),
+			GameType:   room.GameType,
+			Teams:      convertTeamsToAPITeams(g.teams),
+			Spectators: room.SpectatorNames(),
+			Settings:   convertSettingsToAPISettings(g.settings),
 		}
 
-		log.Printf("Sending out updated room messages\n")
+		g.room.Logger().Debug("Sending out updated room messages")
 
 		if justJoinedClient != nil {
 			//log.Printf("Player just rejoined, sending updated-room event\n")
@@ -565,9 +722,10 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 	if g.gameJustStarted {
 		updatedGameEvent.Cards = g.cards
 		updatedGameEvent.SpymasterCardIndices = g.teams[0].cardIndices
-	} else if justJoinedClient != nil {
+	} else if justJoinedClient != nil || g.playersChanged {
 		updatedGameEvent.GameType = room.GameType
 		updatedGameEvent.Teams = convertTeamsToAPITeams(g.teams)
+		updatedGameEvent.Spectators = room.SpectatorNames()
 		updatedGameEvent.Settings = convertSettingsToAPISettings(g.settings)
 	}
 	msgToTeam1Spymaster.Body = updatedGameEvent
@@ -583,9 +741,10 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 	if g.gameJustStarted {
 		updatedGameEvent.Cards = g.cards
 		updatedGameEvent.SpymasterCardIndices = g.teams[1].cardIndices
-	} else if justJoinedClient != nil {
+	} else if justJoinedClient != nil || g.playersChanged {
 		updatedGameEvent.GameType = room.GameType
 		updatedGameEvent.Teams = convertTeamsToAPITeams(g.teams)
+		updatedGameEvent.Spectators = room.SpectatorNames()
 		updatedGameEvent.Settings = convertSettingsToAPISettings(g.settings)
 	}
 	msgToTeam2Spymaster.Body = updatedGameEvent
@@ -600,9 +759,12 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 	}
 	if g.gameJustStarted {
 		updatedGameEvent.Cards = g.cards
-	} else if justJoinedClient != nil {
+	} else if justJoinedClient != nil || g.playersChanged {
+		// Anyone who just arrived needs the board, but never the key.
+		updatedGameEvent.Cards = g.cards
 		updatedGameEvent.GameType = room.GameType
 		updatedGameEvent.Teams = convertTeamsToAPITeams(g.teams)
+		updatedGameEvent.Spectators = room.SpectatorNames()
 		updatedGameEvent.Settings = convertSettingsToAPISettings(g.settings)
 	}
 	msgToPlayers.Body = updatedGameEvent
@@ -617,28 +779,32 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 
 		team2Spymaster := g.teams[1].players[codenames_api.PlayerSpymaster]
 		g.sendOutgoingMessages(&models.OutgoingMessageRequest{
-			PrimaryClient: team2Spymaster,
+			PrimaryClient: team2Spymaster.Client,
 			PrimaryMsg:    &msgToTeam2Spymaster,
 			SecondaryMsg:  &msgToPlayers,
 			Room:          room,
 		})
 	} else if justJoinedClient != nil {
-		var justJoinedPlayer *models.Player
+		// Only the client that just joined needs the whole game. The
+		// key is only sent out when the game starts, so a spymaster who
+		// reloaded, or whose room was restored, needs their team's again.
+		msgToJustJoined := msgToPlayers
 		for _, team := range g.teams {
-			for _, player := range team.players {
-				if player != nil && player.Client == justJoinedClient {
-					justJoinedPlayer = player
-					break
-				}
+			spymaster := team.players[codenames_api.PlayerSpymaster]
+			if spymaster != nil && spymaster.Client == justJoinedClient {
+				spymaster.Logger().Debug(
+					"Spymaster just rejoined, sending updated-game event with key")
+
+				spymasterEvent := updatedGameEvent
+				spymasterEvent.SpymasterCardIndices = team.cardIndices
+				msgToJustJoined.Body = spymasterEvent
 			}
 		}
 
-		log.Printf("Player %s just rejoined, sending updated-game event\n",
-			justJoinedPlayer.Name)
-
 		g.sendOutgoingMessages(&models.OutgoingMessageRequest{
-			SecondaryMsg: &msgToPlayers,
-			Room:         room,
+			PrimaryClient: justJoinedClient,
+			PrimaryMsg:    &msgToJustJoined,
+			Room:          room,
 		})
 	} else {
 		g.sendOutgoingMessages(&models.OutgoingMessageRequest{
@@ -648,7 +814,7 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 	}
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) validateStateTransition(fromState, toState string) bool {
 	valid, ok := validStateTransitions[fromState]
 	if !ok {
@@ -670,32 +836,37 @@ func (g *Game) performRoomChecks(
 ) (*models.GameRoom, error) {
 	room := player.Room
 	if room == nil {
-		return nil, errors.New("you are not in a game")
+		return nil, models.NewError(api.ErrorNotInRoom,
+			"you are not in a game")
 	}
 
 	/* TODO
 	if _, ok := h.rooms[room.roomCode]; !ok {
-		return nil, errors.New("this game no longer exists")
+		return nil, models.NewError(api.ErrorRoomNotFound,
+			"this game no longer exists")
 	}
 	*/
 
-	room.LastInteractionTime = time.Now()
+	room.Touch()
 
 	if playerMustBeRoomOwner && !player.IsRoomOwner {
-		return nil, errors.New("you are not the game owner")
+		return nil, models.NewError(api.ErrorNotRoomOwner,
+			"you are not the game owner")
 	}
 
 	if playerMustBeCurrentSpymaster {
 		currentSpymaster := g.getCurrentSpymaster(room)
 		if currentSpymaster.Name != player.Name {
-			return nil, errors.New("you are not the current spymaster")
+			return nil, models.NewError(api.ErrorNotYourTurn,
+				"you are not the current spymaster")
 		}
 	}
 
 	if playerMustBeCurrentGuesser {
 		currentGuesser := g.getCurrentGuesser(room)
 		if currentGuesser.Name != player.Name {
-			return nil, errors.New("you are not the current guesser")
+			return nil, models.NewError(api.ErrorNotYourTurn,
+				"you are not the current guesser")
 		}
 	}
 
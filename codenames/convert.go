@@ -13,6 +13,7 @@ func convertPlayersToAPIPlayers(
 		apiPlayers = append(apiPlayers, codenames_api.Player{
 			Name:           player.Name,
 			IsRoomOwner:    player.IsRoomOwner,
+			Connected:      player.IsConnected(),
 		})
 	}
 	return apiPlayers
@@ -32,8 +33,7 @@ func convertTeamToAPITeam(team *team) codenames_api.Team {
 		apiPlayers = append(apiPlayers, convertPlayerToAPIPlayer(player))
 	}
 	return codenames_api.Team{
-		Players:     apiPlayers,
-		CardIndices: team.cardIndices,
+		Players: apiPlayers,
 	}
 }
 
@@ -45,6 +45,7 @@ func convertPlayerToAPIPlayer(player *models.Player) *codenames_api.Player {
 	return &codenames_api.Player{
 		Name: player.Name,
 		IsRoomOwner: player.IsRoomOwner,
+		Connected: player.IsConnected(),
 	}
 }
 
@@ -0,0 +1,111 @@
+package codenames
+
+import (
+	"encoding/json"
+	"fmt"
+
+	codenames_api "github.com/sndurkin/game-night-in/codenames/api"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// gameSnapshot holds the persisted state of a game, including the key.
+// Players are referred to by name, with empty slots left blank.
+type gameSnapshot struct {
+	Settings codenames_api.GameSettings `json:"settings"`
+
+	State              string   `json:"state"`
+	Cards              []string `json:"cards"`
+	AssassinCardIdx    int      `json:"assassinCardIdx"`
+	CardIndicesGuessed []int    `json:"cardIndicesGuessed"`
+	NumCardsInTurn     int      `json:"numCardsInTurn"`
+
+	Teams                []teamSnapshot `json:"teams"`
+	WinningTeam          *int           `json:"winningTeam,omitempty"`
+	CurrentlyPlayingTeam int            `json:"currentlyPlayingTeam"`
+
+	PreviouslyUsedCards []string `json:"previouslyUsedCards"`
+}
+
+type teamSnapshot struct {
+	Players     []string `json:"players"`
+	CardIndices []int    `json:"cardIndices"`
+}
+
+// Snapshot serializes the full state of the game.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) Snapshot() (json.RawMessage, error) {
+	teams := make([]teamSnapshot, 0, len(g.teams))
+	for _, team := range g.teams {
+		names := make([]string, 0, len(team.players))
+		for _, player := range team.players {
+			if player == nil {
+				names = append(names, "")
+			} else {
+				names = append(names, player.Name)
+			}
+		}
+		teams = append(teams, teamSnapshot{
+			Players:     names,
+			CardIndices: team.cardIndices,
+		})
+	}
+
+	return json.Marshal(gameSnapshot{
+		Settings:             convertSettingsToAPISettings(g.settings),
+		State:                g.state,
+		Cards:                g.cards,
+		AssassinCardIdx:      g.assassinCardIdx,
+		CardIndicesGuessed:   g.cardIndicesGuessed,
+		NumCardsInTurn:       g.numCardsInTurn,
+		Teams:                teams,
+		WinningTeam:          g.winningTeam,
+		CurrentlyPlayingTeam: g.currentlyPlayingTeam,
+		PreviouslyUsedCards:  g.previouslyUsedCards,
+	})
+}
+
+// Restore replaces the state of the game with a snapshot.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) Restore(data json.RawMessage) error {
+	var snapshot gameSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	teams := make([]*team, 0, len(snapshot.Teams))
+	for _, teamSnapshot := range snapshot.Teams {
+		players := make([]*models.Player, 0, len(teamSnapshot.Players))
+		for _, name := range teamSnapshot.Players {
+			if name == "" {
+				players = append(players, nil)
+				continue
+			}
+
+			player := g.room.FindPlayer(name)
+			if player == nil {
+				return fmt.Errorf("player %s is not in room %s", name,
+					g.room.RoomCode)
+			}
+			players = append(players, player)
+		}
+		teams = append(teams, &team{
+			players:     players,
+			cardIndices: teamSnapshot.CardIndices,
+		})
+	}
+
+	g.settings = convertAPISettingsToSettings(snapshot.Settings)
+	g.state = snapshot.State
+	g.cards = snapshot.Cards
+	g.assassinCardIdx = snapshot.AssassinCardIdx
+	g.cardIndicesGuessed = snapshot.CardIndicesGuessed
+	g.numCardsInTurn = snapshot.NumCardsInTurn
+	g.teams = teams
+	g.winningTeam = snapshot.WinningTeam
+	g.currentlyPlayingTeam = snapshot.CurrentlyPlayingTeam
+	g.previouslyUsedCards = snapshot.PreviouslyUsedCards
+
+	return nil
+}
@@ -0,0 +1,451 @@
+// Package config holds the settings of the server. They start out with
+// their defaults, which can be changed by a JSON file and then by
+// environment variables, and are validated before the server starts.
+//
+// The environment variable of a setting is given by the env tag of its
+// field, which is prefixed with the env tag of the section it is in.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/roomcode"
+)
+
+// Config holds every setting of the server.
+type Config struct {
+	Server      ServerConfig     `json:"server"`
+	Connections ConnectionConfig `json:"connections"`
+	RateLimits  RateLimitConfig  `json:"rateLimits"`
+	Rooms       RoomConfig       `json:"rooms"`
+	Fishbowl    FishbowlConfig   `json:"fishbowl" env:"FISHBOWL"`
+	Codenames   CodenamesConfig  `json:"codenames" env:"CODENAMES"`
+}
+
+// ServerConfig holds the settings of the HTTP server and its logs.
+type ServerConfig struct {
+	Port string `json:"port" env:"PORT" validate:"required,max=5"`
+
+	// Directory that rooms are saved to, so that they survive restarts.
+	SnapshotDir string `json:"snapshotDir" env:"SNAPSHOT_DIR" validate:"required"`
+
+	// IP addresses or CIDR networks of the reverse proxies in front of
+	// the server. Clients are told apart by the X-Forwarded-For header
+	// only when it comes from one of them.
+	TrustedProxies []string `json:"trustedProxies" env:"TRUSTED_PROXIES"`
+
+	// Token that the admin API requires, which is disabled if it is
+	// empty.
+	AdminToken string `json:"adminToken" env:"ADMIN_TOKEN" secret:"true"`
+
+	LogLevel  string `json:"logLevel" env:"LOG_LEVEL" validate:"oneof=debug info warn error"`
+	LogFormat string `json:"logFormat" env:"LOG_FORMAT" validate:"oneof=logfmt json"`
+}
+
+// ConnectionConfig holds the settings of the websocket connections.
+type ConnectionConfig struct {
+	// Time allowed to write a message to the peer.
+	WriteWait Duration `json:"writeWait" env:"WRITE_WAIT"`
+
+	// Time allowed to read the next pong message from the peer. Pings
+	// are sent a little more often than this.
+	PongWait Duration `json:"pongWait" env:"PONG_WAIT"`
+
+	// Maximum message size allowed from the peer, in bytes. Larger
+	// messages close the connection instead of getting an error, so it
+	// must fit the largest valid request. The limits of the requests
+	// count characters, and each can take up to 12 bytes when escaped.
+	MaxMessageSize int `json:"maxMessageSize" env:"MAX_MESSAGE_SIZE" validate:"min=64"`
+
+	// How long a client can leave its messages waiting before it is
+	// considered gone and disconnected.
+	SlowClientTimeout Duration `json:"slowClientTimeout" env:"SLOW_CLIENT_TIMEOUT"`
+
+	// Maximum number of messages waiting for a client. State updates
+	// replace each other, so this is only a safety net for the memory
+	// of the server: slow clients are disconnected by the timeout long
+	// before they get there.
+	MaxQueuedMessages int `json:"maxQueuedMessages" env:"MAX_QUEUED_MESSAGES" validate:"min=1024"`
+
+	// Maximum number of websocket connections open at once from the
+	// same IP address.
+	MaxConnectionsPerIP int `json:"maxConnectionsPerIP" env:"MAX_CONNECTIONS_PER_IP" validate:"min=1"`
+}
+
+// RateLimit describes a token bucket: Rate tokens are added every
+// second, up to Burst tokens.
+type RateLimit struct {
+	Rate  float64 `json:"rate" env:"RATE" validate:"min=0"`
+	Burst float64 `json:"burst" env:"BURST" validate:"min=1"`
+}
+
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%g/s burst %g", l.Rate, l.Burst)
+}
+
+// RateLimitConfig holds the limits on the messages of a connection.
+type RateLimitConfig struct {
+	// Limit on all of the messages sent by a connection.
+	Connection RateLimit `json:"connection" env:"RATE_LIMIT_CONNECTION"`
+
+	// Limit on each action sent by a connection, unless it is listed
+	// in Actions.
+	DefaultAction RateLimit `json:"defaultAction" env:"RATE_LIMIT_ACTION"`
+
+	// Limits on specific actions, by protocol name.
+	Actions map[string]RateLimit `json:"actions" validate:"dive"`
+}
+
+// RoomConfig holds the settings of the game rooms.
+type RoomConfig struct {
+	// Kind of room codes, and their number of digits, characters or
+	// words.
+	CodeScheme string `json:"codeScheme" env:"ROOM_CODE_SCHEME" validate:"oneof=numeric alphanumeric words"`
+	CodeLength int    `json:"codeLength" env:"ROOM_CODE_LENGTH" validate:"min=1"`
+
+	// How long the code of an expired room is not given to a new room,
+	// so that players who come back late do not join strangers. Zero
+	// lets codes be reused right away.
+	CodeReuseDelay Duration `json:"codeReuseDelay" env:"ROOM_CODE_REUSE_DELAY"`
+
+	// How long a room is kept after it was last interacted with, and
+	// how often expired rooms are looked for.
+	Expiry          Duration `json:"expiry" env:"ROOM_EXPIRY"`
+	CleanupInterval Duration `json:"cleanupInterval" env:"ROOM_CLEANUP_INTERVAL"`
+
+	// How often every room is saved to the snapshot directory.
+	SnapshotInterval Duration `json:"snapshotInterval" env:"SNAPSHOT_INTERVAL"`
+
+	// How long the owner of a room can be disconnected before another
+	// player is made the owner.
+	OwnerHandoffDelay Duration `json:"ownerHandoffDelay" env:"OWNER_HANDOFF_DELAY"`
+
+	// Maximum number of rooms that clients from the same IP address can
+	// have created and not yet expired.
+	MaxRoomsPerIP int `json:"maxRoomsPerIP" env:"MAX_ROOMS_PER_IP" validate:"min=1"`
+
+	// Number of wrong room passwords that clients from the same IP
+	// address can try before they are locked out, and for how long.
+	PasswordAttempts int      `json:"passwordAttempts" env:"PASSWORD_ATTEMPTS" validate:"min=1"`
+	PasswordLockout  Duration `json:"passwordLockout" env:"PASSWORD_LOCKOUT"`
+}
+
+// FishbowlConfig holds the settings that new Fishbowl games start with.
+// They have the same limits as the settings players can choose.
+type FishbowlConfig struct {
+	Rounds           []string `json:"rounds" env:"ROUNDS" validate:"required,max=10,dive,oneof=describe single charades"`
+	TimerLength      int      `json:"timerLength" env:"TIMER_LENGTH" validate:"min=5,max=600"`
+	NumWordsRequired int      `json:"numWordsRequired" env:"NUM_WORDS_REQUIRED" validate:"min=0,max=50"`
+	MaxSkipsPerTurn  int      `json:"maxSkipsPerTurn" env:"MAX_SKIPS_PER_TURN" validate:"min=0,max=100"`
+}
+
+// CodenamesConfig holds the settings of Codenames games.
+type CodenamesConfig struct {
+	// Files that the words on the cards are picked from, one per line.
+	WordLists []string `json:"wordLists" env:"WORD_LISTS" validate:"required,dive,required"`
+}
+
+// Default returns the settings the server uses unless they are changed.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:        "3000",
+			SnapshotDir: "data/rooms",
+			LogLevel:    "info",
+			LogFormat:   "logfmt",
+		},
+		Connections: ConnectionConfig{
+			WriteWait:           Duration{10 * time.Second},
+			PongWait:            Duration{60 * time.Second},
+			MaxMessageSize:      65536,
+			SlowClientTimeout:   Duration{30 * time.Second},
+			MaxQueuedMessages:   10000,
+			MaxConnectionsPerIP: 20,
+		},
+		RateLimits: RateLimitConfig{
+			Connection:    RateLimit{Rate: 10, Burst: 20},
+			DefaultAction: RateLimit{Rate: 5, Burst: 10},
+			Actions: map[string]RateLimit{
+				"create-game": {Rate: 0.2, Burst: 3},
+				"join-game":   {Rate: 1, Burst: 5},
+				"send-chat":   {Rate: 1, Burst: 5},
+			},
+		},
+		Rooms: RoomConfig{
+			CodeScheme:        "numeric",
+			CodeLength:        4,
+			CodeReuseDelay:    Duration{time.Hour},
+			Expiry:            Duration{time.Hour},
+			CleanupInterval:   Duration{time.Hour},
+			SnapshotInterval:  Duration{30 * time.Second},
+			OwnerHandoffDelay: Duration{2 * time.Minute},
+			MaxRoomsPerIP:     5,
+			PasswordAttempts:  5,
+			PasswordLockout:   Duration{15 * time.Minute},
+		},
+		Fishbowl: FishbowlConfig{
+			Rounds:           []string{"describe", "single", "charades"},
+			TimerLength:      30,
+			NumWordsRequired: 5,
+			MaxSkipsPerTurn:  1,
+		},
+		Codenames: CodenamesConfig{
+			WordLists: []string{"./codenames/codenames-words.txt"},
+		},
+	}
+}
+
+// Load returns the default settings, changed by the JSON file at path
+// unless it is empty, and then by the environment variables that are
+// set. It returns an error if the file cannot be read or any setting
+// is invalid.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), ""); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if err := api.Validate(c); err != nil {
+		return err
+	}
+
+	durations := map[string]Duration{
+		"connections.writeWait":         c.Connections.WriteWait,
+		"connections.pongWait":          c.Connections.PongWait,
+		"connections.slowClientTimeout": c.Connections.SlowClientTimeout,
+		"rooms.expiry":                  c.Rooms.Expiry,
+		"rooms.cleanupInterval":         c.Rooms.CleanupInterval,
+		"rooms.snapshotInterval":        c.Rooms.SnapshotInterval,
+		"rooms.ownerHandoffDelay":       c.Rooms.OwnerHandoffDelay,
+		"rooms.passwordLockout":         c.Rooms.PasswordLockout,
+	}
+	for name, d := range durations {
+		if d.Duration <= 0 {
+			return fmt.Errorf("The %s setting must be a positive duration.",
+				name)
+		}
+	}
+
+	if c.Rooms.CodeReuseDelay.Duration < 0 {
+		return fmt.Errorf(
+			"The rooms.codeReuseDelay setting must not be negative.")
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := ParseNetwork(proxy); err != nil {
+			return fmt.Errorf("The server.trustedProxies setting is invalid: %v.",
+				err)
+		}
+	}
+
+	if _, err := roomcode.New(c.Rooms.CodeScheme, c.Rooms.CodeLength); err != nil {
+		return fmt.Errorf("The rooms.codeLength setting is invalid: %v.", err)
+	}
+	return nil
+}
+
+// ParseNetwork parses a CIDR network, or a single IP address as the
+// network of just that address.
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not an IP address", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// applyEnv sets the fields of a section from the environment variables
+// named by their env tags, with the given prefix.
+func applyEnv(section reflect.Value, prefix string) error {
+	t := section.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := field.Tag.Lookup("env")
+		if prefix != "" && ok {
+			name = prefix + "_" + name
+		} else if !ok {
+			name = prefix
+		}
+
+		v := section.Field(i)
+		if v.Kind() == reflect.Struct && v.Type() != durationType {
+			// Sections without an env tag do not add to the prefix.
+			if err := applyEnv(v, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(v, value); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func setFromString(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(Duration{d}))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(x)
+	case reflect.Slice:
+		// Lists are comma-separated.
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+
+	return nil
+}
+
+// Fields returns every setting as alternating names and values, e.g.
+// for logging them. Secrets are left out, with only whether they are
+// set.
+func (c *Config) Fields() []interface{} {
+	var fields []interface{}
+	appendFields(&fields, reflect.ValueOf(*c), "")
+	return fields
+}
+
+func appendFields(fields *[]interface{}, v reflect.Value, path string) {
+	if _, ok := v.Interface().(fmt.Stringer); ok {
+		*fields = append(*fields, path, v.Interface())
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := joinPath(path, strings.Split(field.Tag.Get("json"), ",")[0])
+			if field.Tag.Get("secret") == "true" {
+				*fields = append(*fields, name, v.Field(i).String() != "")
+				continue
+			}
+			appendFields(fields, v.Field(i), name)
+		}
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			appendFields(fields, v.MapIndex(reflect.ValueOf(key)),
+				joinPath(path, key))
+		}
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		*fields = append(*fields, path, strings.Join(items, ","))
+	default:
+		*fields = append(*fields, path, v.Interface())
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Duration is a time.Duration that is written as a string in JSON,
+// e.g. "90s" or "2m".
+type Duration struct {
+	time.Duration
+}
+
+var durationType = reflect.TypeOf(Duration{})
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"30s\"")
+	}
+
+	var err error
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setEnv sets the environment variables, and returns a function that
+// restores them.
+func setEnv(vars map[string]string) func() {
+	old := make(map[string]*string)
+	for name, value := range vars {
+		if prev, ok := os.LookupEnv(name); ok {
+			old[name] = &prev
+		} else {
+			old[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+
+	return func() {
+		for name, prev := range old {
+			if prev == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *prev)
+			}
+		}
+	}
+}
+
+// writeConfigFile writes a settings file, and returns its path.
+func writeConfigFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "config-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		setting func(c *Config) interface{}
+		want    interface{}
+	}{
+		{
+			name:    "default",
+			setting: func(c *Config) interface{} { return c.Server.Port },
+			want:    "3000",
+		},
+		{
+			name:    "file overrides the default",
+			file:    `{"server": {"port": "4000"}}`,
+			setting: func(c *Config) interface{} { return c.Server.Port },
+			want:    "4000",
+		},
+		{
+			name:    "environment overrides the default",
+			env:     map[string]string{"PORT": "5000"},
+			setting: func(c *Config) interface{} { return c.Server.Port },
+			want:    "5000",
+		},
+		{
+			name:    "environment overrides the file",
+			file:    `{"server": {"port": "4000"}}`,
+			env:     map[string]string{"PORT": "5000"},
+			setting: func(c *Config) interface{} { return c.Server.Port },
+			want:    "5000",
+		},
+		{
+			name:    "file keeps the other defaults of a section",
+			file:    `{"server": {"port": "4000"}}`,
+			setting: func(c *Config) interface{} { return c.Server.LogLevel },
+			want:    "info",
+		},
+		{
+			name: "file keeps the other defaults of a nested section",
+			file: `{"rateLimits": {"connection": {"burst": 50}}}`,
+			setting: func(c *Config) interface{} {
+				return c.RateLimits.Connection
+			},
+			want: RateLimit{Rate: 10, Burst: 50},
+		},
+		{
+			name: "environment of a nested section",
+			file: `{"rateLimits": {"connection": {"burst": 50}}}`,
+			env:  map[string]string{"RATE_LIMIT_CONNECTION_BURST": "60"},
+			setting: func(c *Config) interface{} {
+				return c.RateLimits.Connection
+			},
+			want: RateLimit{Rate: 10, Burst: 60},
+		},
+		{
+			name: "environment of a prefixed section",
+			env:  map[string]string{"FISHBOWL_ROUNDS": "describe, charades"},
+			setting: func(c *Config) interface{} {
+				return c.Fishbowl.Rounds
+			},
+			want: []string{"describe", "charades"},
+		},
+		{
+			name: "durations",
+			file: `{"rooms": {"expiry": "90m", "cleanupInterval": "5m"}}`,
+			env:  map[string]string{"ROOM_EXPIRY": "2h"},
+			setting: func(c *Config) interface{} {
+				return []time.Duration{
+					c.Rooms.Expiry.Duration,
+					c.Rooms.CleanupInterval.Duration,
+				}
+			},
+			want: []time.Duration{2 * time.Hour, 5 * time.Minute},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer setEnv(test.env)()
+
+			var path string
+			if test.file != "" {
+				path = writeConfigFile(t, test.file)
+				defer os.Remove(path)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			if got := test.setting(cfg); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("setting = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{
+			name: "unknown setting in the file",
+			file: `{"server": {"prot": "4000"}}`,
+		},
+		{
+			name: "malformed file",
+			file: `{"server": `,
+		},
+		{
+			name: "malformed duration in the file",
+			file: `{"rooms": {"expiry": 90}}`,
+		},
+		{
+			name: "malformed number in the environment",
+			env:  map[string]string{"MAX_ROOMS_PER_IP": "many"},
+		},
+		{
+			name: "invalid setting in the file",
+			file: `{"server": {"logLevel": "verbose"}}`,
+		},
+		{
+			name: "invalid setting in the environment",
+			env:  map[string]string{"FISHBOWL_TIMER_LENGTH": "1"},
+		},
+		{
+			name: "invalid trusted proxy",
+			env:  map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8, proxy"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer setEnv(test.env)()
+
+			var path string
+			if test.file != "" {
+				path = writeConfigFile(t, test.file)
+				defer os.Remove(path)
+			}
+
+			if _, err := Load(path); err == nil {
+				t.Errorf("Load() did not return an error")
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load("does-not-exist.json"); err == nil {
+		t.Errorf("Load() did not return an error")
+	}
+}
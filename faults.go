@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// watchRoomFaults makes the hub tell everyone in the room when one of
+// its actions panics.
+func (h *Hub) watchRoomFaults(room *models.GameRoom) {
+	room.OnFault = func() {
+		h.roomFaulted(room)
+	}
+}
+
+// roomFaulted lets the players and spectators of a room know that the
+// game stopped working. The other rooms carry on as normal.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) roomFaulted(room *models.GameRoom) {
+	room.Logger().Error("Room is faulted", "error", room.Fault.Error)
+
+	members := append(room.Players[:len(room.Players):len(room.Players)],
+		room.Spectators...)
+	for _, player := range members {
+		// The action that panicked never got to clear it.
+		requestID := player.RequestID
+		player.RequestID = ""
+		player.Action = ""
+
+		if player.Client == nil {
+			continue
+		}
+
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: &models.Player{
+				Client:    player.Client,
+				RequestID: requestID,
+			},
+			Error: "Something went wrong with this game. The room owner " +
+				"can start a rematch to reset it.",
+			Code: api.ErrorRoomFaulted,
+		})
+	}
+}
+
+// resetRoom replaces the game of a room with a new one, which keeps the
+// players and the owner but starts over in the waiting room. It also
+// clears a fault.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) resetRoom(room *models.GameRoom) {
+	room.Logger().Info("Resetting room")
+
+	// The games clear the owner of the players who join them.
+	var owner *models.Player
+	for _, player := range room.Players {
+		if player.IsRoomOwner {
+			owner = player
+			break
+		}
+	}
+
+	def, _ := models.LookupGame(room.GameType)
+	room.Game.Stop()
+	room.Fault = nil
+	room.Game = def.NewGame(room, h.sendOutgoingMessages, h.sendErrorMessage)
+	for idx, player := range room.Players {
+		if idx == 0 {
+			room.Game.AddPlayer(player)
+			continue
+		}
+
+		room.Game.Join(player, true, api.JoinGameRequest{
+			RoomCode: room.RoomCode,
+			Name:     player.Name,
+		})
+	}
+
+	if owner != nil {
+		h.setRoomOwner(room, owner)
+	} else {
+		room.Game.UpdatePlayers()
+	}
+}
+
+// rejectIfFaulted lets the player know if their room is faulted, in
+// which case the game must not be touched until the room is reset.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) rejectIfFaulted(player *models.Player) bool {
+	if player.Room == nil || player.Room.Fault == nil {
+		return false
+	}
+
+	h.sendErrorMessage(&models.ErrorMessageRequest{
+		Player: player,
+		Error: "Something went wrong with this game. The room owner " +
+			"can start a rematch to reset it.",
+		Code: api.ErrorRoomFaulted,
+	})
+	return true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sndurkin/game-night-in/config"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+func TestResetRoom(t *testing.T) {
+	cfg := config.Default()
+	models.InitGames(cfg)
+	h := newHub(cfg, nil)
+
+	tests := []struct {
+		name     string
+		gameType string
+		players  []string
+		// The player who owns the room before it is reset, or -1 if
+		// nobody does.
+		owner int
+	}{
+		{"fishbowl creator", "fishbowl", []string{"Ada", "Bob", "Cy"}, 0},
+		{"fishbowl new owner", "fishbowl", []string{"Ada", "Bob", "Cy"}, 2},
+		{"fishbowl no owner", "fishbowl", []string{"Ada", "Bob"}, -1},
+		{"codenames creator", "codenames", []string{"Ada", "Bob", "Cy"}, 0},
+		{"codenames new owner", "codenames", []string{"Ada", "Bob", "Cy"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := newTestRoom(h, test.gameType, test.players...)
+			for idx, player := range room.Players {
+				player.IsRoomOwner = idx == test.owner
+			}
+			room.Fault = &models.RoomFault{Error: "test"}
+			game := room.Game
+
+			h.resetRoom(room)
+
+			if room.Game == game {
+				t.Errorf("resetRoom() kept the old game")
+			}
+			if room.Fault != nil {
+				t.Errorf("resetRoom() did not clear the fault")
+			}
+			if state := room.Game.State(); state != "waiting-room" {
+				t.Errorf("State() = %s, want waiting-room", state)
+			}
+			if len(room.Players) != len(test.players) {
+				t.Fatalf("resetRoom() left %d players, want %d",
+					len(room.Players), len(test.players))
+			}
+			for idx, player := range room.Players {
+				if player.Name != test.players[idx] {
+					t.Errorf("Players[%d] = %s, want %s", idx, player.Name,
+						test.players[idx])
+				}
+				if player.Room != room {
+					t.Errorf("%s is no longer in the room", player.Name)
+				}
+				if owner := idx == test.owner; player.IsRoomOwner != owner {
+					t.Errorf("%s IsRoomOwner = %v, want %v", player.Name,
+						player.IsRoomOwner, owner)
+				}
+			}
+		})
+	}
+}
@@ -8,30 +8,31 @@ type RoundT int
 type Player struct {
 	Name           string `json:"name"`
 	IsRoomOwner    bool   `json:"isRoomOwner,omitempty"`
+	Connected      bool   `json:"connected"`
 	WordsSubmitted bool   `json:"wordsSubmitted"`
 }
 
 // GameSettings holds all the relevant information about a game's
 // settings.
 type GameSettings struct {
-	Rounds           []string `json:"rounds"`
-	TimerLength      int      `json:"timerLength"`
-	NumWordsRequired int      `json:"numWordsRequired"`
-	MaxSkipsPerTurn  int      `json:"maxSkipsPerTurn"`
+	Rounds           []string `json:"rounds" validate:"required,max=10,dive,enum=fishbowl-round"`
+	TimerLength      int      `json:"timerLength" validate:"min=5,max=600"`
+	NumWordsRequired int      `json:"numWordsRequired" validate:"min=0,max=50"`
+	MaxSkipsPerTurn  int      `json:"maxSkipsPerTurn" validate:"min=0,max=100"`
 }
 
 // SubmitWordsRequest is used by clients to submit words for the
 // Fishbowl game.
 type SubmitWordsRequest struct {
-	Words []string `json:"words"`
+	Words []string `json:"words" validate:"max=50,dive,required,max=100"`
 }
 
 // MovePlayerRequest is used by the owner of a room to move a player
 // from one team to another.
 type MovePlayerRequest struct {
-	PlayerName string `json:"playerName"`
-	FromTeam   int    `json:"fromTeam"`
-	ToTeam     int    `json:"toTeam"`
+	PlayerName string `json:"playerName" validate:"required,max=40"`
+	FromTeam   int    `json:"fromTeam" validate:"min=0"`
+	ToTeam     int    `json:"toTeam" validate:"min=0"`
 }
 
 // AddTeamRequest is used by the owner of a room to add a new
@@ -41,7 +42,7 @@ type AddTeamRequest struct{}
 // RemoveTeamRequest is used by the owner of a room to remove a
 // team from the game.
 type RemoveTeamRequest struct {
-	Team int `json:"team"`
+	Team int `json:"team" validate:"min=0"`
 }
 
 // ChangeSettingsRequest is used by the owner of a room to change
@@ -57,7 +58,7 @@ type StartTurnRequest struct{}
 // either mark the card correct or skip and move to
 // the next card.
 type ChangeCardRequest struct {
-	ChangeType string `json:"changeType"`
+	ChangeType string `json:"changeType" validate:"oneof=correct skip"`
 }
 
 // CreatedGameEvent is an event that is sent to a player
@@ -73,17 +74,19 @@ type CreatedGameEvent struct {
 // in a room whenever a change has been made to it (e.g. player joining,
 // player switching teams, etc).
 type UpdatedRoomEvent struct {
-	GameType string       `json:"gameType"`
-	Teams    [][]Player   `json:"teams"`
-	Settings GameSettings `json:"settings"`
+	GameType   string       `json:"gameType"`
+	Teams      [][]Player   `json:"teams"`
+	Spectators []string     `json:"spectators"`
+	Settings   GameSettings `json:"settings"`
 }
 
 // UpdatedGameEvent is an event that is sent to all players
 // playing a game whenever a change has been made to its state.
 type UpdatedGameEvent struct {
-	GameType string       `json:"gameType"`
-	Teams    [][]Player   `json:"teams,omitempty"`
-	Settings GameSettings `json:"settings"`
+	GameType   string       `json:"gameType"`
+	Teams      [][]Player   `json:"teams,omitempty"`
+	Spectators []string     `json:"spectators,omitempty"`
+	Settings   GameSettings `json:"settings"`
 
 	State                 string  `json:"state"`
 	CurrentServerTime     int64   `json:"currentServerTime,omitempty"`
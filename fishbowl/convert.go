@@ -8,12 +8,14 @@ import (
 func convertPlayersToAPIPlayers(
 	players []*models.Player,
 	settings *gameSettings,
+	playersSettings map[string]*playerSettings,
 ) []fishbowl_api.Player {
 	apiPlayers := make([]fishbowl_api.Player, 0, len(players))
 	for _, player := range players {
 		apiPlayers = append(apiPlayers, fishbowl_api.Player{
 			Name:           player.Name,
 			IsRoomOwner:    player.IsRoomOwner,
+			Connected:      player.IsConnected(),
 			WordsSubmitted: len(playersSettings[player.Name].words) >= settings.numWordsRequired,
 		})
 	}
@@ -23,11 +25,12 @@ func convertPlayersToAPIPlayers(
 func convertTeamsToAPITeams(
 	teams [][]*models.Player,
 	settings *gameSettings,
+	playersSettings map[string]*playerSettings,
 ) [][]fishbowl_api.Player {
 	apiTeams := make([][]fishbowl_api.Player, 0, len(teams))
 	for _, players := range teams {
 		apiTeams = append(apiTeams,
-			convertPlayersToAPIPlayers(players, settings))
+			convertPlayersToAPIPlayers(players, settings, playersSettings))
 	}
 	return apiTeams
 }
@@ -2,14 +2,12 @@ package fishbowl
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
 	"math/rand"
-	"sync"
 	"time"
 
 	api "github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/config"
 	fishbowl_api "github.com/sndurkin/game-night-in/fishbowl/api"
 	"github.com/sndurkin/game-night-in/models"
 	"github.com/sndurkin/game-night-in/util"
@@ -22,13 +20,14 @@ type playerSettings struct {
 
 // Game holds the game-specific data and logic.
 type Game struct {
-	mutex                *sync.RWMutex
 	sendOutgoingMessages models.OutgoingMessageRequestFn
 	sendErrorMessage     models.ErrorMessageRequestFn
 	room                 *models.GameRoom
 	settings             *gameSettings
+	playersSettings      map[string]*playerSettings
 
 	state                 string
+	playersChanged        bool
 	turnJustStarted       bool
 	turnContinued         bool
 	cardsInRound          []string
@@ -71,38 +70,80 @@ var (
 			"waiting-room",
 		},
 	}
-
-	playersSettings = make(map[string]*playerSettings)
 )
 
+func init() {
+	actions := make([]string, 0, len(fishbowl_api.Action))
+	for actionType, action := range fishbowl_api.Action {
+		if actionType != fishbowl_api.ActionInvalid {
+			actions = append(actions, action)
+		}
+	}
+
+	models.RegisterGame(&models.GameDefinition{
+		GameType:    "fishbowl",
+		DisplayName: "Fishbowl",
+		Description: "Describe, act out and guess the phrases " +
+			"everyone put in the bowl.",
+		MinPlayers: 4,
+		DefaultSettings: func() interface{} {
+			return convertSettingsToAPISettings(newDefaultSettings())
+		},
+		Actions:  actions,
+		Features: []string{"turn-timer", "custom-rounds", "card-skips"},
+		Init:     Init,
+		NewGame: func(
+			gameRoom *models.GameRoom,
+			sendOutgoingMessages models.OutgoingMessageRequestFn,
+			sendErrorMessage models.ErrorMessageRequestFn,
+		) models.Game {
+			return NewGame(gameRoom, sendOutgoingMessages, sendErrorMessage)
+		},
+	})
+}
+
+// The settings that new games start with.
+var defaults config.FishbowlConfig
+
 // Init is called on program startup.
-func Init() {
+func Init(cfg *config.Config) {
 	fishbowl_api.Init()
+	defaults = cfg.Fishbowl
+
+	api.RegisterEnum("fishbowl-round", func(value string) bool {
+		_, ok := fishbowl_api.RoundLookup[value]
+		return ok
+	})
+}
+
+// newDefaultSettings returns the settings that a new game starts with.
+func newDefaultSettings() *gameSettings {
+	rounds := make([]fishbowl_api.RoundT, 0, len(defaults.Rounds))
+	for _, round := range defaults.Rounds {
+		rounds = append(rounds, fishbowl_api.RoundLookup[round])
+	}
+
+	return &gameSettings{
+		rounds:           rounds,
+		timerLength:      defaults.TimerLength,
+		numWordsRequired: defaults.NumWordsRequired,
+		maxSkipsPerTurn:  defaults.MaxSkipsPerTurn,
+	}
 }
 
 func NewGame(
 	gameRoom *models.GameRoom,
-	mutex *sync.RWMutex,
 	sendOutgoingMessages models.OutgoingMessageRequestFn,
 	sendErrorMessage models.ErrorMessageRequestFn,
 ) *Game {
 	g := &Game{
-		mutex:                mutex,
 		sendOutgoingMessages: sendOutgoingMessages,
 		sendErrorMessage:     sendErrorMessage,
-		settings: &gameSettings{
-			rounds: []fishbowl_api.RoundT{
-				fishbowl_api.RoundDescribe,
-				fishbowl_api.RoundSingleWord,
-				fishbowl_api.RoundCharades,
-			},
-			timerLength:      30,
-			numWordsRequired: 5,
-			maxSkipsPerTurn:  1,
-		},
-		room:  gameRoom,
-		state: "waiting-room",
-		teams: make([][]*models.Player, 2),
+		settings:             newDefaultSettings(),
+		playersSettings:      make(map[string]*playerSettings),
+		room:                 gameRoom,
+		state:                "waiting-room",
+		teams:                make([][]*models.Player, 2),
 	}
 
 	g.teams[0] = make([]*models.Player, 0)
@@ -118,54 +159,81 @@ func (g *Game) HandleIncomingMessage(
 ) {
 	actionType, ok := fishbowl_api.ActionLookup[incomingMessage.Action]
 	if !ok {
-		log.Printf("Invalid fishbowl action: %s\n", incomingMessage.Action)
+		player.Logger().Info("Invalid action",
+			"gameAction", incomingMessage.Action)
+		g.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That is not a valid action.",
+			Code:   api.ErrorInvalidAction,
+		})
+		return
 	}
 
 	switch actionType {
 	case fishbowl_api.ActionAddTeam:
 		var req fishbowl_api.AddTeamRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.addTeam(player, req)
 	case fishbowl_api.ActionRemoveTeam:
 		var req fishbowl_api.RemoveTeamRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.removeTeam(player, req)
 	case fishbowl_api.ActionMovePlayer:
 		var req fishbowl_api.MovePlayerRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.movePlayer(player, req)
 	case fishbowl_api.ActionChangeSettings:
 		var req fishbowl_api.ChangeSettingsRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.changeSettings(player, req)
 	case fishbowl_api.ActionStartTurn:
 		var req fishbowl_api.StartTurnRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.startTurn(player, req)
 	case fishbowl_api.ActionSubmitWords:
 		var req fishbowl_api.SubmitWordsRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.submitWords(player, req)
 	case fishbowl_api.ActionChangeCard:
 		var req fishbowl_api.ChangeCardRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			player.Logger().Info("Invalid request", "error", err)
+			g.sendErrorMessage(models.NewRequestError(player, err))
+			return
 		}
 		g.changeCard(player, req)
 	default:
-		log.Printf("Could not handle incoming action: %s", incomingMessage.Action)
+		player.Logger().Warn("Could not handle incoming action",
+			"gameAction", incomingMessage.Action)
+		g.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That is not a valid action.",
+			Code:   api.ErrorInvalidAction,
+		})
 	}
 }
 
@@ -173,16 +241,14 @@ func (g *Game) addTeam(
 	player *models.Player,
 	req fishbowl_api.AddTeamRequest,
 ) {
-	log.Printf("Add team request\n")
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Add team request")
 
 	_, err := g.performRoomChecks(player, true, false)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -195,16 +261,14 @@ func (g *Game) removeTeam(
 	player *models.Player,
 	req fishbowl_api.RemoveTeamRequest,
 ) {
-	log.Printf("Remove team request: %d\n", req.Team)
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Remove team request", "team", req.Team)
 
 	_, err := g.performRoomChecks(player, true, false)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -213,6 +277,7 @@ func (g *Game) removeTeam(
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "That is not a valid team to remove.",
+			Code:   api.ErrorInvalidRequest,
 		})
 		return
 	}
@@ -229,34 +294,37 @@ func (g *Game) movePlayer(
 	player *models.Player,
 	req fishbowl_api.MovePlayerRequest,
 ) {
-	log.Printf("Move player request: %s (%d -> %d)\n", req.PlayerName,
-		req.FromTeam, req.ToTeam)
-
-	var msg api.OutgoingMessage
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Move player request", "moved", req.PlayerName,
+		"fromTeam", req.FromTeam, "toTeam", req.ToTeam)
 
 	room, err := g.performRoomChecks(player, true, false)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
 
 	if req.FromTeam >= len(g.teams) || req.ToTeam >= len(g.teams) {
-		msg.Event = "error"
-		msg.Error = "The team indexes are invalid."
-		g.sendOutgoingMessages(&models.OutgoingMessageRequest{
-			PrimaryClient: player.Client,
-			PrimaryMsg:    &msg,
+		g.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "The team indexes are invalid.",
+			Code:   api.ErrorInvalidRequest,
 		})
 		return
 	}
 
 	playerToMove := g.removePlayerFromTeam(room, req.PlayerName)
+	if playerToMove == nil {
+		g.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That player is not in the game.",
+			Code:   api.ErrorInvalidRequest,
+		})
+		return
+	}
 	g.teams[req.ToTeam] = append(g.teams[req.ToTeam], playerToMove)
 
 	g.sendUpdatedGameMessages(nil)
@@ -266,16 +334,14 @@ func (g *Game) changeSettings(
 	player *models.Player,
 	req fishbowl_api.ChangeSettingsRequest,
 ) {
-	log.Printf("Change settings request\n")
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Change settings request")
 
 	_, err := g.performRoomChecks(player, true, false)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -288,16 +354,14 @@ func (g *Game) startTurn(
 	player *models.Player,
 	req fishbowl_api.StartTurnRequest,
 ) {
-	log.Printf("Start turn request\n")
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Start turn request")
 
 	_, err := g.performRoomChecks(player, false, true)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -306,6 +370,7 @@ func (g *Game) startTurn(
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot perform that action at this time.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
@@ -318,50 +383,64 @@ func (g *Game) startTurn(
 		g.timerLength = g.settings.timerLength + 2
 	}
 	g.currentServerTime = time.Now().UnixNano() / 1000000
+	g.startTimer(time.Second * time.Duration(g.timerLength))
+
+	g.sendUpdatedGameMessages(nil)
+}
+
+// startTimer (re)starts the turn timer so that the turn ends after
+// the given duration.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) startTimer(d time.Duration) {
 	if g.timer != nil {
 		g.timer.Stop()
 	}
-	g.timer = time.NewTimer(time.Second * time.Duration(g.timerLength))
-
-	// Wait for timer to finish in an asynchronous goroutine
-	go func() {
-		// Block until timer finishes. When it is done, it sends a message
-		// on the channel timer.C. No other code in
-		// this goroutine is executed until that happens.
-		<-g.timer.C
 
-		log.Println("Timer expired, waiting on lock")
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		// The timer fires on its own goroutine, so hand the expiry over
+		// to the room's goroutine.
+		g.room.Do(func() {
+			g.expireTimer(timer)
+		})
+	})
+	g.timer = timer
+}
 
-		g.mutex.Lock()
-		defer g.mutex.Unlock()
+// expireTimer ends the current turn when its timer runs out.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) expireTimer(timer *time.Timer) {
+	if g.timer != timer {
+		// The timer was stopped or replaced after it had already fired.
+		return
+	}
 
-		log.Println(" - lock obtained")
+	g.room.Logger().Info("Timer expired", "state", g.state)
 
-		g.timer = nil
-		g.turnContinued = false
-
-		log.Printf("Game state when timer ended: %s\n", g.state)
-		if !g.validateStateTransition(g.state, "turn-start") {
-			if g.state == "turn-start" || g.state == "game-over" {
-				// Round or game finished before the player's turn timer expired,
-				// so do nothing.
-				return
-			}
+	g.timer = nil
+	g.turnContinued = false
 
-			log.Printf("Game was not in correct state when turn timer expired: %s",
-				g.state)
+	if !g.validateStateTransition(g.state, "turn-start") {
+		if g.state == "turn-start" || g.state == "game-over" {
+			// Round or game finished before the player's turn timer expired,
+			// so do nothing.
 			return
 		}
 
-		g.turnJustStarted = false
-		g.state = "turn-start"
-		g.moveToNextPlayerAndTeam()
-		g.reshuffleCards()
+		g.room.Logger().Warn(
+			"Game was not in correct state when turn timer expired",
+			"state", g.state)
+		return
+	}
 
-		log.Printf("Sending updated game message after timer expired\n")
-		g.sendUpdatedGameMessages(nil)
-	}()
+	g.turnJustStarted = false
+	g.state = "turn-start"
+	g.moveToNextPlayerAndTeam()
+	g.reshuffleCards()
 
+	g.room.Logger().Debug("Sending updated game message after timer expired")
 	g.sendUpdatedGameMessages(nil)
 }
 
@@ -369,16 +448,14 @@ func (g *Game) submitWords(
 	player *models.Player,
 	req fishbowl_api.SubmitWordsRequest,
 ) {
-	log.Printf("Submit words request: %s\n", req.Words)
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Submit words request", "words", len(req.Words))
 
 	_, err := g.performRoomChecks(player, false, false)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -388,11 +465,12 @@ func (g *Game) submitWords(
 			Player: player,
 			Error: fmt.Sprintf("At least %d words are required.",
 				g.settings.numWordsRequired),
+			Code: api.ErrorInvalidRequest,
 		})
 		return
 	}
 
-	playersSettings[player.Name].words = req.Words
+	g.playersSettings[player.Name].words = req.Words
 	g.sendUpdatedGameMessages(nil)
 }
 
@@ -400,16 +478,14 @@ func (g *Game) changeCard(
 	player *models.Player,
 	req fishbowl_api.ChangeCardRequest,
 ) {
-	log.Printf("Change card request: %s\n", req.ChangeType)
-
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	player.Logger().Info("Change card request", "changeType", req.ChangeType)
 
 	_, err := g.performRoomChecks(player, false, true)
 	if err != nil {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -462,6 +538,7 @@ func (g *Game) changeCard(
 				g.timerLength = g.timerLength - int(time.Since(startTime).Seconds())
 				g.turnContinued = true
 				g.timer.Stop()
+				g.timer = nil
 			}
 
 			g.currentRound++
@@ -488,9 +565,9 @@ func (g *Game) changeCard(
 
 // AddPlayer adds a player to the current game.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) AddPlayer(player *models.Player) {
-	playersSettings[player.Name] = &playerSettings{
+	g.playersSettings[player.Name] = &playerSettings{
 		words: []string{},
 	}
 
@@ -501,13 +578,15 @@ func (g *Game) AddPlayer(player *models.Player) {
 	msg.Body = fishbowl_api.CreatedGameEvent{
 		GameType: g.room.GameType,
 		RoomCode: g.room.RoomCode,
-		Teams:    convertTeamsToAPITeams(g.teams, g.settings),
+		Teams: convertTeamsToAPITeams(g.teams, g.settings,
+			g.playersSettings),
 		Settings: convertSettingsToAPISettings(g.settings),
 	}
 
 	g.sendOutgoingMessages(&models.OutgoingMessageRequest{
 		PrimaryClient: player.Client,
 		PrimaryMsg:    &msg,
+		Room:          g.room,
 	})
 }
 
@@ -518,7 +597,8 @@ func (g *Game) Join(
 ) {
 	if !newPlayerJoined {
 		// Only the player's connection was updated, a new player has not joined.
-		log.Printf("Sending game message because new player has not joined\n")
+		player.Logger().Debug(
+			"Sending game message because new player has not joined")
 		g.sendUpdatedGameMessages(player.Client)
 		return
 	}
@@ -527,6 +607,7 @@ func (g *Game) Join(
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot join a game that has already started.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
@@ -535,7 +616,7 @@ func (g *Game) Join(
 	player.Name = req.Name
 	player.Room = g.room
 	player.IsRoomOwner = false
-	playersSettings[player.Name] = &playerSettings{
+	g.playersSettings[player.Name] = &playerSettings{
 		words: []string{},
 	}
 
@@ -545,15 +626,26 @@ func (g *Game) Join(
 
 // Start starts the game.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) Start(player *models.Player) {
 	if !g.validateStateTransition(g.state, "turn-start") {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot perform that action at this time.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
+	for _, players := range g.teams {
+		if len(players) == 0 {
+			g.sendErrorMessage(&models.ErrorMessageRequest{
+				Player: player,
+				Error:  "Every team needs a player to start the game.",
+				Code:   api.ErrorInvalidState,
+			})
+			return
+		}
+	}
 	g.turnJustStarted = true
 	g.state = "turn-start"
 
@@ -573,7 +665,7 @@ func (g *Game) Start(player *models.Player) {
 
 // Kick removes a player from the game.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) Kick(playerName string) {
 	playerToKick := g.removePlayerFromTeam(g.room, playerName)
 	playerToKick.Room = nil
@@ -582,14 +674,76 @@ func (g *Game) Kick(playerName string) {
 	g.sendUpdatedGameMessages(nil)
 }
 
+// UpdatePlayers sends the teams to every player in the room.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) UpdatePlayers() {
+	g.playersChanged = true
+	g.sendUpdatedGameMessages(nil)
+	g.playersChanged = false
+}
+
+// PlayerTeam returns the index of the player's team, or -1.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) PlayerTeam(player *models.Player) int {
+	for teamIdx, teamPlayers := range g.teams {
+		for _, p := range teamPlayers {
+			if p == player {
+				return teamIdx
+			}
+		}
+	}
+
+	return -1
+}
+
+// State returns the current state of the game.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) State() string {
+	return g.state
+}
+
+// PlayerLimits returns the limits of Fishbowl, which needs two teams of
+// two and takes any number of players beyond that.
+func (g *Game) PlayerLimits() (int, int) {
+	return 4, 0
+}
+
+// Stop stops the turn timer, so that it does not fire on a game that
+// has been thrown away.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) Stop() {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+}
+
+// CheckChat keeps the player who is describing the current card out of
+// the chat until their turn is over.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) CheckChat(player *models.Player, channel string) error {
+	if g.state == "turn-active" && g.getCurrentPlayer(g.room) == player {
+		return models.NewError(api.ErrorForbidden,
+			"You cannot chat while it is your turn.")
+	}
+
+	return nil
+}
+
 // Rematch starts a new game with the same players and settings.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) Rematch(player *models.Player) {
 	if !g.validateStateTransition(g.state, "waiting-room") {
 		g.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "You cannot perform that action at this time.",
+			Code:   api.ErrorInvalidState,
 		})
 		return
 	}
@@ -601,15 +755,15 @@ func (g *Game) Rematch(player *models.Player) {
 
 	for _, teamPlayers := range g.teams {
 		for _, player := range teamPlayers {
-			playersSettings[player.Name].words = []string{}
+			g.playersSettings[player.Name].words = []string{}
 		}
 	}
 
-	log.Println("Sending out updated game messages for rematch")
+	g.room.Logger().Debug("Sending out updated game messages for rematch")
 	g.sendUpdatedGameMessages(nil)
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) removePlayerFromTeam(
 	room *models.GameRoom,
 	playerName string,
@@ -639,23 +793,23 @@ func (g *Game) initGameScores() {
 // This is used to remove excess words players may have submitted
 // before a settings change.
 //
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) removeExcessSubmittedWords() {
 	for _, teamPlayers := range g.teams {
 		for _, player := range teamPlayers {
-			playerSettings := playersSettings[player.Name]
+			playerSettings := g.playersSettings[player.Name]
 			playerSettings.words = playerSettings.words[:g.settings.numWordsRequired]
 		}
 	}
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) reshuffleCardsForRound() {
 	g.cardsInRound = []string{}
 	for _, teamPlayers := range g.teams {
 		for _, player := range teamPlayers {
 			g.cardsInRound = append(g.cardsInRound,
-				playersSettings[player.Name].words...)
+				g.playersSettings[player.Name].words...)
 		}
 	}
 	g.totalNumCards = len(g.cardsInRound)
@@ -663,7 +817,7 @@ func (g *Game) reshuffleCardsForRound() {
 	g.reshuffleCards()
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) reshuffleCards() {
 	arr := g.cardsInRound
 	rand.Shuffle(len(g.cardsInRound), func(i, j int) {
@@ -671,20 +825,20 @@ func (g *Game) reshuffleCards() {
 	})
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) moveToNextPlayerAndTeam() {
 	t := g.currentlyPlayingTeam
 	g.currentPlayers[t] = (g.currentPlayers[t] + 1) % len(g.teams[t])
 	g.currentlyPlayingTeam = (t + 1) % len(g.currentPlayers)
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) getCurrentPlayer(room *models.GameRoom) *models.Player {
 	players := g.teams[g.currentlyPlayingTeam]
 	return players[g.currentPlayers[g.currentlyPlayingTeam]]
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 	room := g.room
 	if g.state == "waiting-room" {
@@ -692,11 +846,13 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 		msg.Event = api.Event[api.EventUpdatedRoom]
 		msg.Body = fishbowl_api.UpdatedRoomEvent{
 			GameType: room.GameType,
-			Teams:    convertTeamsToAPITeams(g.teams, g.settings),
-			Settings: convertSettingsToAPISettings(g.settings),
+			Teams: convertTeamsToAPITeams(g.teams, g.settings,
+				g.playersSettings),
+			Spectators: room.SpectatorNames(),
+			Settings:   convertSettingsToAPISettings(g.settings),
 		}
 
-		log.Printf("Sending out updated room messages\n")
+		g.room.Logger().Debug("Sending out updated room messages")
 
 		if justJoinedClient != nil {
 			//log.Printf("Player just rejoined, sending updated-room event\n")
@@ -724,7 +880,7 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 	if g.state == "turn-active" {
 		currentCard = g.cardsInRound[0]
 
-		if g.turnJustStarted || justJoinedClient != nil {
+		if g.turnJustStarted || justJoinedClient != nil || g.playersChanged {
 			currentServerTime = g.currentServerTime
 			timerLength = g.timerLength
 		}
@@ -747,9 +903,11 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 		CurrentPlayers:        g.currentPlayers,
 		CurrentlyPlayingTeam:  g.currentlyPlayingTeam,
 	}
-	if justJoinedClient != nil {
+	if justJoinedClient != nil || g.playersChanged {
 		updatedGameEvent.GameType = room.GameType
-		updatedGameEvent.Teams = convertTeamsToAPITeams(g.teams, g.settings)
+		updatedGameEvent.Teams = convertTeamsToAPITeams(g.teams, g.settings,
+			g.playersSettings)
+		updatedGameEvent.Spectators = room.SpectatorNames()
 		updatedGameEvent.Settings = convertSettingsToAPISettings(g.settings)
 	}
 	msgToCurrentPlayer.Body = updatedGameEvent
@@ -770,9 +928,11 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 		CurrentPlayers:        g.currentPlayers,
 		CurrentlyPlayingTeam:  g.currentlyPlayingTeam,
 	}
-	if justJoinedClient != nil {
+	if justJoinedClient != nil || g.playersChanged {
 		updatedGameEvent.GameType = room.GameType
-		updatedGameEvent.Teams = convertTeamsToAPITeams(g.teams, g.settings)
+		updatedGameEvent.Teams = convertTeamsToAPITeams(g.teams, g.settings,
+			g.playersSettings)
+		updatedGameEvent.Spectators = room.SpectatorNames()
 		updatedGameEvent.Settings = convertSettingsToAPISettings(
 			g.settings)
 	}
@@ -787,8 +947,8 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 			}
 		}
 
-		log.Printf("Player %s just rejoined, sending updated-game event\n",
-			justJoinedPlayer.Name)
+		justJoinedPlayer.Logger().Debug(
+			"Player just rejoined, sending updated-game event")
 		if currentPlayer.Client == justJoinedClient {
 			g.sendOutgoingMessages(&models.OutgoingMessageRequest{
 				PrimaryClient: justJoinedClient,
@@ -812,7 +972,7 @@ func (g *Game) sendUpdatedGameMessages(justJoinedClient interface{}) {
 	}
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
 func (g *Game) validateStateTransition(fromState, toState string) bool {
 	valid, ok := validStateTransitions[fromState]
 	if !ok {
@@ -833,25 +993,29 @@ func (g *Game) performRoomChecks(
 ) (*models.GameRoom, error) {
 	room := player.Room
 	if room == nil {
-		return nil, errors.New("you are not in a game")
+		return nil, models.NewError(api.ErrorNotInRoom,
+			"you are not in a game")
 	}
 
 	/* TODO
 	if _, ok := h.rooms[room.roomCode]; !ok {
-		return nil, errors.New("this game no longer exists")
+		return nil, models.NewError(api.ErrorRoomNotFound,
+			"this game no longer exists")
 	}
 	*/
 
-	room.LastInteractionTime = time.Now()
+	room.Touch()
 
 	if playerMustBeRoomOwner && !player.IsRoomOwner {
-		return nil, errors.New("you are not the game owner")
+		return nil, models.NewError(api.ErrorNotRoomOwner,
+			"you are not the game owner")
 	}
 
 	if playerMustBeCurrentPlayer {
 		currentPlayer := g.getCurrentPlayer(room)
 		if currentPlayer.Name != player.Name {
-			return nil, errors.New("you are not the current player")
+			return nil, models.NewError(api.ErrorNotYourTurn,
+				"you are not the current player")
 		}
 	}
 
@@ -0,0 +1,137 @@
+package fishbowl
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	fishbowl_api "github.com/sndurkin/game-night-in/fishbowl/api"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// gameSnapshot holds the persisted state of a game. Players are
+// referred to by name.
+type gameSnapshot struct {
+	Settings        fishbowl_api.GameSettings `json:"settings"`
+	PlayersSettings map[string][]string       `json:"playersSettings"`
+
+	State                 string     `json:"state"`
+	TurnJustStarted       bool       `json:"turnJustStarted"`
+	TurnContinued         bool       `json:"turnContinued"`
+	CardsInRound          []string   `json:"cardsInRound"`
+	CurrentServerTime     int64      `json:"currentServerTime"`
+	TimerRunning          bool       `json:"timerRunning"`
+	TimerLength           int        `json:"timerLength"`
+	LastCardGuessed       string     `json:"lastCardGuessed"`
+	TotalNumCards         int        `json:"totalNumCards"`
+	NumCardsGuessedInTurn int        `json:"numCardsGuessedInTurn"`
+	Teams                 [][]string `json:"teams"`
+	TeamScoresByRound     [][]int    `json:"teamScoresByRound"`
+	WinningTeam           *int       `json:"winningTeam,omitempty"`
+	CurrentRound          int        `json:"currentRound"`
+	CurrentPlayers        []int      `json:"currentPlayers"`
+	CurrentlyPlayingTeam  int        `json:"currentlyPlayingTeam"`
+}
+
+// Snapshot serializes the full state of the game.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) Snapshot() (json.RawMessage, error) {
+	playersSettings := make(map[string][]string, len(g.playersSettings))
+	for name, settings := range g.playersSettings {
+		playersSettings[name] = settings.words
+	}
+
+	teams := make([][]string, 0, len(g.teams))
+	for _, teamPlayers := range g.teams {
+		names := make([]string, 0, len(teamPlayers))
+		for _, player := range teamPlayers {
+			names = append(names, player.Name)
+		}
+		teams = append(teams, names)
+	}
+
+	return json.Marshal(gameSnapshot{
+		Settings:              convertSettingsToAPISettings(g.settings),
+		PlayersSettings:       playersSettings,
+		State:                 g.state,
+		TurnJustStarted:       g.turnJustStarted,
+		TurnContinued:         g.turnContinued,
+		CardsInRound:          g.cardsInRound,
+		CurrentServerTime:     g.currentServerTime,
+		TimerRunning:          g.timer != nil,
+		TimerLength:           g.timerLength,
+		LastCardGuessed:       g.lastCardGuessed,
+		TotalNumCards:         g.totalNumCards,
+		NumCardsGuessedInTurn: g.numCardsGuessedInTurn,
+		Teams:                 teams,
+		TeamScoresByRound:     g.teamScoresByRound,
+		WinningTeam:           g.winningTeam,
+		CurrentRound:          g.currentRound,
+		CurrentPlayers:        g.currentPlayers,
+		CurrentlyPlayingTeam:  g.currentlyPlayingTeam,
+	})
+}
+
+// Restore replaces the state of the game with a snapshot. If a turn
+// was in progress, its timer resumes with whatever time it had left.
+//
+// This function must be called from the room's goroutine.
+func (g *Game) Restore(data json.RawMessage) error {
+	var snapshot gameSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	teams := make([][]*models.Player, 0, len(snapshot.Teams))
+	for _, names := range snapshot.Teams {
+		teamPlayers := make([]*models.Player, 0, len(names))
+		for _, name := range names {
+			player := g.room.FindPlayer(name)
+			if player == nil {
+				return fmt.Errorf("player %s is not in room %s", name,
+					g.room.RoomCode)
+			}
+			teamPlayers = append(teamPlayers, player)
+		}
+		teams = append(teams, teamPlayers)
+	}
+
+	g.settings = convertAPISettingsToSettings(snapshot.Settings)
+	g.playersSettings = make(map[string]*playerSettings,
+		len(snapshot.PlayersSettings))
+	for name, words := range snapshot.PlayersSettings {
+		g.playersSettings[name] = &playerSettings{
+			words: words,
+		}
+	}
+
+	g.state = snapshot.State
+	g.turnJustStarted = snapshot.TurnJustStarted
+	g.turnContinued = snapshot.TurnContinued
+	g.cardsInRound = snapshot.CardsInRound
+	g.currentServerTime = snapshot.CurrentServerTime
+	g.timerLength = snapshot.TimerLength
+	g.lastCardGuessed = snapshot.LastCardGuessed
+	g.totalNumCards = snapshot.TotalNumCards
+	g.numCardsGuessedInTurn = snapshot.NumCardsGuessedInTurn
+	g.teams = teams
+	g.teamScoresByRound = snapshot.TeamScoresByRound
+	g.winningTeam = snapshot.WinningTeam
+	g.currentRound = snapshot.CurrentRound
+	g.currentPlayers = snapshot.CurrentPlayers
+	g.currentlyPlayingTeam = snapshot.CurrentlyPlayingTeam
+
+	if snapshot.TimerRunning && g.state == "turn-active" {
+		startTime := time.Unix(g.currentServerTime/1000,
+			(g.currentServerTime%1000)*1000000)
+		remaining := time.Second*time.Duration(g.timerLength) -
+			time.Since(startTime)
+		if remaining < 0 {
+			remaining = 0
+		}
+		g.startTimer(remaining)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/logging"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+const (
+	// The protocol version of clients that do not say which one they
+	// speak, which predate the handshake.
+	legacyProtocolVersion = 1
+
+	// The first protocol version that accepts several messages in one
+	// websocket message.
+	batchedMessagesProtocolVersion = 2
+)
+
+// negotiateProtocolVersion returns the protocol version to speak with a
+// client whose newest version is clientVersion, or false if the client
+// is too old.
+func negotiateProtocolVersion(clientVersion int) (int, bool) {
+	if clientVersion < api.MinProtocolVersion {
+		return 0, false
+	}
+
+	if clientVersion > api.ProtocolVersion {
+		return api.ProtocolVersion, true
+	}
+	return clientVersion, true
+}
+
+// hello agrees on a protocol version with a client, and tells it what
+// the server supports.
+func (h *Hub) hello(client *Client, requestID string, req api.HelloRequest) {
+	logging.Info("Hello from client", "ip", client.ip,
+		"protocolVersion", req.ProtocolVersion,
+		"capabilities", strings.Join(req.Capabilities, ","))
+
+	version, ok := negotiateProtocolVersion(req.ProtocolVersion)
+	if !ok {
+		h.rejectProtocolVersion(client, requestID, req.ProtocolVersion)
+		return
+	}
+	client.setProtocolVersion(version)
+
+	games := []api.GameFeatures{}
+	for _, def := range models.RegisteredGames() {
+		features := def.Features
+		if features == nil {
+			features = []string{}
+		}
+		games = append(games, api.GameFeatures{
+			GameType: def.GameType,
+			Features: features,
+		})
+	}
+
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventWelcome]
+	msg.RequestID = requestID
+	msg.Body = api.WelcomeEvent{
+		ProtocolVersion:       version,
+		ServerProtocolVersion: api.ProtocolVersion,
+		Capabilities:          api.Capabilities,
+		Games:                 games,
+	}
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		PrimaryClient: client,
+		PrimaryMsg:    &msg,
+	})
+}
+
+// rejectProtocolVersion tells a client that its protocol version is no
+// longer supported and disconnects it. The message is also a fatal
+// error, so that clients which predate this event still show it.
+func (h *Hub) rejectProtocolVersion(
+	client *Client,
+	requestID string,
+	clientVersion int,
+) {
+	logging.Info("Rejecting client", "ip", client.ip,
+		"protocolVersion", clientVersion)
+
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventIncompatibleVersion]
+	msg.RequestID = requestID
+	msg.Error = "This page is out of date, please reload it."
+	msg.ErrorCode = api.ErrorCode[api.ErrorIncompatibleVersion]
+	msg.ErrorIsFatal = true
+	msg.Body = api.IncompatibleVersionEvent{
+		ProtocolVersion:    clientVersion,
+		MinProtocolVersion: api.MinProtocolVersion,
+		MaxProtocolVersion: api.ProtocolVersion,
+	}
+	output, err := json.Marshal(msg)
+	if err != nil {
+		logging.Error("Could not marshal message", "error", err)
+	} else {
+		client.trySend(output)
+	}
+	client.closeSend()
+}
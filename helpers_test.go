@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/config"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// newTestHub returns a hub with the default settings, which does not
+// save its rooms.
+func newTestHub() *Hub {
+	cfg := config.Default()
+	api.Init()
+	models.InitGames(cfg)
+	return newHub(cfg, nil)
+}
+
+// newTestConn returns the server side of a websocket connection, which
+// is closed when the test ends.
+func newTestConn(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err == nil {
+				conns <- conn
+			}
+		}))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	peer, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Could not connect to the test server: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// newTestClient returns a client of the hub whose messages are kept in
+// its outbox, since nothing writes them to its connection.
+func newTestClient(t *testing.T, h *Hub, ip string) *Client {
+	client := &Client{
+		hub:             h,
+		conn:            newTestConn(t),
+		send:            newOutbox(h.cfg.Connections),
+		ip:              ip,
+		limiter:         newClientRateLimiter(h.cfg.RateLimits),
+		protocolVersion: api.ProtocolVersion,
+	}
+	h.addLiveClient(client)
+	return client
+}
+
+// takeMessages returns the messages waiting for a test client.
+func takeMessages(t *testing.T, c *Client) []api.OutgoingMessage {
+	t.Helper()
+
+	data, _ := c.send.take()
+	messages := make([]api.OutgoingMessage, len(data))
+	for i, msg := range data {
+		if err := json.Unmarshal(msg, &messages[i]); err != nil {
+			t.Fatalf("Could not read message %s: %v", msg, err)
+		}
+	}
+	return messages
+}
+
+// takeErrorCodes returns the error codes of the messages waiting for a
+// test client.
+func takeErrorCodes(t *testing.T, c *Client) []string {
+	t.Helper()
+
+	var codes []string
+	for _, msg := range takeMessages(t, c) {
+		if msg.ErrorCode != "" {
+			codes = append(codes, msg.ErrorCode)
+		}
+	}
+	return codes
+}
+
+// inTestRoom runs fn on the room's goroutine once the actions queued
+// before it are done, and waits for it.
+func inTestRoom(t *testing.T, room *models.GameRoom, fn func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	if !room.Do(func() {
+		defer close(done)
+		fn()
+	}) {
+		t.Fatal("The room is closed")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The room did not run the action")
+	}
+}
+
+// createTestRoom has a client create a room, and returns it once the
+// client has been seated. The room is closed when the test ends.
+func createTestRoom(
+	t *testing.T,
+	h *Hub,
+	client *Client,
+	req api.CreateGameRequest,
+) *models.GameRoom {
+	t.Helper()
+
+	h.createGame(client, "", req)
+
+	h.mutex.RLock()
+	room := client.room
+	h.mutex.RUnlock()
+	if room == nil {
+		t.Fatalf("Could not create a room: %v", takeErrorCodes(t, client))
+	}
+	t.Cleanup(room.Close)
+
+	inTestRoom(t, room, func() {})
+	return room
+}
+
+// joinTestRoom has a client join a room, and waits for the room to
+// handle it.
+func joinTestRoom(
+	t *testing.T,
+	h *Hub,
+	client *Client,
+	room *models.GameRoom,
+	req api.JoinGameRequest,
+) {
+	t.Helper()
+
+	req.RoomCode = room.RoomCode
+	h.joinGame(client, "", req)
+	inTestRoom(t, room, func() {})
+}
+
+// sendTestMessage has a client send a message to the hub, and waits for
+// the room to handle it.
+func sendTestMessage(
+	t *testing.T,
+	h *Hub,
+	client *Client,
+	room *models.GameRoom,
+	action string,
+	body interface{},
+) {
+	t.Helper()
+
+	message, err := json.Marshal(map[string]interface{}{
+		"action": action,
+		"body":   body,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.handleIncomingMessage(&ClientMessage{message: message, client: client})
+	inTestRoom(t, room, func() {})
+}
+
+// newTestRoom returns a room of the given game, with players of the
+// given names who have no connection. The first one created it. The
+// room is not running, so it can be changed from the test's goroutine.
+func newTestRoom(h *Hub, gameType string, names ...string) *models.GameRoom {
+	def, _ := models.LookupGame(gameType)
+	room := models.NewGameRoom("1234", gameType)
+	room.Game = def.NewGame(room, h.sendOutgoingMessages, h.sendErrorMessage)
+
+	for idx, name := range names {
+		player := &models.Player{}
+		room.Players = append(room.Players, player)
+		if idx == 0 {
+			player.Name = name
+			player.Room = room
+			player.IsRoomOwner = true
+			room.Game.AddPlayer(player)
+			continue
+		}
+
+		room.Game.Join(player, true, api.JoinGameRequest{
+			RoomCode: room.RoomCode,
+			Name:     name,
+		})
+	}
+	return room
+}
@@ -1,32 +1,73 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
-	"errors"
-	"log"
-	"net"
-	"strconv"
 	"sync"
 	"time"
 
 	"github.com/sndurkin/game-night-in/api"
-	"github.com/sndurkin/game-night-in/codenames"
-	"github.com/sndurkin/game-night-in/fishbowl"
+	"github.com/sndurkin/game-night-in/config"
+	"github.com/sndurkin/game-night-in/logging"
 	"github.com/sndurkin/game-night-in/models"
+	"github.com/sndurkin/game-night-in/roomcode"
 	"github.com/sndurkin/game-night-in/util"
 )
 
-// Hub maintains the set of active clients and broadcasts messages to the
-// clients.
+// Hub maintains the set of active clients and routes their messages
+// to the rooms, each of which runs game actions on its own goroutine.
 type Hub struct {
+	// Guards playerClients, liveClients, rooms, roomCreators,
+	// freedRoomCodes and the room of each client. It must never be held
+	// while waiting on a room.
 	mutex sync.RWMutex
 
 	// Map of connected client to Player
 	playerClients map[*Client]*models.Player
 
+	// Every open connection, from when it is upgraded until its
+	// writePump finishes, whether or not the hub has registered it.
+	liveClients map[*Client]bool
+
 	// Map of room code to GameRoom
 	rooms map[string]*models.GameRoom
 
+	// Map of room code to the IP address of the client that created it
+	roomCreators map[string]string
+
+	// Map of the code of each room that was closed recently to the time
+	// it was closed, so that it is not given to a new room too soon.
+	freedRoomCodes map[string]time.Time
+
+	// How the codes of new rooms are made.
+	roomCodes roomcode.Scheme
+
+	// Open connections of each IP address
+	connections *connectionLimiter
+
+	// Reverse proxies that are trusted to say where clients connect from
+	proxies proxyList
+
+	// Wrong room passwords tried by each IP address
+	passwords *passwordLimiter
+
+	// Public rooms, and the clients that follow them
+	lobby *lobby
+
+	// Where room snapshots are persisted, or nil if they are not.
+	store models.RoomStore
+
+	// Settings of the server.
+	cfg *config.Config
+
+	// Set once the server starts shutting down, after which no new
+	// clients or messages are taken. It is guarded by the mutex.
+	shuttingDown bool
+
+	// Running writePumps, which the shutdown waits for so that every
+	// client gets its last messages.
+	writers sync.WaitGroup
+
 	// Inbound messages from the clients.
 	message chan *ClientMessage
 
@@ -39,35 +80,29 @@ type Hub struct {
 
 // newHub creates a new Hub instance which manages all incoming
 // websocket messages.
-func newHub() *Hub {
+func newHub(cfg *config.Config, store models.RoomStore) *Hub {
+	// The settings have already been validated.
+	roomCodes, _ := roomcode.New(cfg.Rooms.CodeScheme, cfg.Rooms.CodeLength)
+	passwords := newPasswordLimiter(cfg.Rooms.PasswordAttempts,
+		cfg.Rooms.PasswordLockout.Duration)
+
 	return &Hub{
-		playerClients: make(map[*Client]*models.Player),
-		rooms:         make(map[string]*models.GameRoom),
-		message:       make(chan *ClientMessage),
-		register:      make(chan *Client),
-		unregister:    make(chan *Client),
-	}
-}
-
-func (h *Hub) newGame(gameType string, room *models.GameRoom) interface{} {
-	switch gameType {
-	case "fishbowl":
-		return fishbowl.NewGame(
-			room,
-			&h.mutex,
-			h.sendOutgoingMessages,
-			h.sendErrorMessage,
-		)
-	case "codenames":
-		return codenames.NewGame(
-			room,
-			&h.mutex,
-			h.sendOutgoingMessages,
-			h.sendErrorMessage,
-		)
+		playerClients:  make(map[*Client]*models.Player),
+		liveClients:    make(map[*Client]bool),
+		rooms:          make(map[string]*models.GameRoom),
+		roomCreators:   make(map[string]string),
+		freedRoomCodes: make(map[string]time.Time),
+		roomCodes:      roomCodes,
+		connections:    newConnectionLimiter(cfg.Connections.MaxConnectionsPerIP),
+		proxies:        newProxyList(cfg.Server.TrustedProxies),
+		passwords:      passwords,
+		lobby:          newLobby(),
+		store:          store,
+		cfg:            cfg,
+		message:        make(chan *ClientMessage),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
 	}
-
-	return nil
 }
 
 func (h *Hub) run() {
@@ -84,157 +119,677 @@ func (h *Hub) run() {
 }
 
 func (h *Hub) registerClient(client *Client) {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+	if declaredVersion := client.declaredProtocolVersion(); declaredVersion != 0 {
+		version, ok := negotiateProtocolVersion(declaredVersion)
+		if !ok {
+			h.rejectProtocolVersion(client, "", declaredVersion)
+			return
+		}
+		client.setProtocolVersion(version)
+	}
 
 	player := &models.Player{
 		Client: client,
 	}
+
+	h.mutex.Lock()
+	if h.shuttingDown {
+		// Connected too late to be disconnected with everyone else.
+		h.mutex.Unlock()
+		h.sendServerRestarting(client)
+		return
+	}
 	h.playerClients[client] = player
+	room, ok := h.rooms[roomcode.Normalize(client.roomCode)]
+	h.mutex.Unlock()
 
-	log.Printf("New client connection: { playerName: '%s', roomCode: '%s' }\n", client.playerName, client.roomCode)
-	if client.playerName != "" && client.roomCode != "" {
-		room, ok := h.rooms[client.roomCode]
-		if ok {
-			matchedPlayer, playerIdx := h.getPlayerInRoom(room, client.playerName)
-			if matchedPlayer != nil {
-				h.rejoinGame(room, client, matchedPlayer, playerIdx)
-			} else {
-				log.Printf("Player not found, sending fatal error\n")
+	logging.Info("New client connection", "ip", client.ip,
+		"room", client.roomCode, "player", client.playerName)
+	if client.playerName == "" || client.roomCode == "" {
+		return
+	}
 
-				h.sendErrorMessage(&models.ErrorMessageRequest{
-					Player: player,
-					Fatal:  true,
-					Error:  "You are no longer part of this game.",
-				})
-				delete(h.playerClients, client)
-			}
-		} else {
-			log.Printf("Room not found, sending fatal error\n")
-			h.sendErrorMessage(&models.ErrorMessageRequest{
-				Player: player,
-				Fatal:  true,
-				Error:  "This game no longer exists.",
-			})
-			delete(h.playerClients, client)
+	if ok {
+		ok = room.Do(func() {
+			h.reconnectClient(room, client, player)
+		})
+	}
+
+	if !ok {
+		logging.Info("Room not found, sending fatal error", "ip", client.ip,
+			"room", client.roomCode, "player", client.playerName)
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Fatal:  true,
+			Error:  "This game no longer exists.",
+			Code:   api.ErrorRoomNotFound,
+		})
+		h.unbindClient(client)
+	}
+}
+
+// reconnectClient attaches a newly connected client to the player it
+// requested in the websocket URL.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) reconnectClient(
+	room *models.GameRoom,
+	client *Client,
+	player *models.Player,
+) {
+	// Reconnecting takes the session token rather than the password, so
+	// players on an IP address that is locked out can still take back
+	// their seats.
+	matchedPlayer, playerIdx := h.getPlayerInRoom(room, client.playerName)
+	if matchedPlayer == nil {
+		if h.rejectIfBanned(room, client, player, client.sessionToken, true) {
+			h.unbindClient(client)
+			return
 		}
+
+		room.Logger().Info("Player not found, sending fatal error",
+			"player", client.playerName)
+
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Fatal:  true,
+			Error:  "You are no longer part of this game.",
+			Code:   api.ErrorSessionInvalid,
+		})
+		h.unbindClient(client)
+		return
+	}
+
+	if !sessionTokenMatches(matchedPlayer, client.sessionToken) {
+		matchedPlayer.Logger().Info(
+			"Invalid session token, sending fatal error")
+
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Fatal:  true,
+			Error:  "Your session for this game is no longer valid.",
+			Code:   api.ErrorSessionInvalid,
+		})
+		h.unbindClient(client)
+		return
 	}
+
+	h.rejoinGame(room, client, matchedPlayer, playerIdx, client.lastSeq)
 }
 
 func (h *Hub) unregisterClient(client *Client) {
+	h.mutex.Lock()
+	player, ok := h.playerClients[client]
+	room := client.room
+	if ok {
+		delete(h.playerClients, client)
+		client.closeSend()
+	}
+	h.mutex.Unlock()
+	h.lobby.unsubscribe(client)
+
+	if ok && room != nil {
+		room.Do(func() {
+			h.playerDisconnected(room, player, client)
+		})
+	}
+}
+
+// playerDisconnected records that a player's connection went away, and
+// schedules a handoff if they own the room.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) playerDisconnected(
+	room *models.GameRoom,
+	player *models.Player,
+	client *Client,
+) {
+	if player.Client != client {
+		// The player has already reconnected with another client.
+		return
+	}
+
+	if player.IsSpectator {
+		// Spectators have no seat to keep, so they simply leave.
+		h.removeSpectator(room, player)
+		room.Game.UpdatePlayers()
+		return
+	}
+	if h.removeFromWaitlist(room, player) {
+		// Neither do players waiting for one.
+		return
+	}
+	h.markDisconnected(room, player)
+}
+
+// markDisconnected records that a player who keeps their seat is no
+// longer connected, and schedules a handoff if they own the room.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) markDisconnected(room *models.GameRoom, player *models.Player) {
+	player.ConnectedAt = time.Time{}
+	player.DisconnectedAt = time.Now()
+	player.LastSeen = player.DisconnectedAt
+	h.sendPresenceEvent(room, player)
+
+	if player.IsRoomOwner {
+		h.scheduleOwnerHandoff(room)
+	}
+}
+
+// scheduleOwnerHandoff checks once the owner handoff delay has passed
+// whether the owner of the room is still disconnected.
+func (h *Hub) scheduleOwnerHandoff(room *models.GameRoom) {
+	time.AfterFunc(h.cfg.Rooms.OwnerHandoffDelay.Duration, func() {
+		room.Do(func() {
+			h.handOffOwnership(room)
+		})
+	})
+}
+
+// handOffOwnership makes the longest-connected player the owner of the
+// room if the owner has been disconnected for at least the owner
+// handoff delay.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) handOffOwnership(room *models.GameRoom) {
+	delay := h.cfg.Rooms.OwnerHandoffDelay.Duration
+	var newOwner *models.Player
+	for _, player := range room.Players {
+		if player.IsRoomOwner && (!player.ConnectedAt.IsZero() ||
+			time.Since(player.DisconnectedAt) < delay) {
+			return
+		}
+
+		if !player.ConnectedAt.IsZero() && (newOwner == nil ||
+			player.ConnectedAt.Before(newOwner.ConnectedAt)) {
+			newOwner = player
+		}
+	}
+
+	if newOwner == nil {
+		// Nobody is connected, so check again later.
+		h.scheduleOwnerHandoff(room)
+		return
+	}
+
+	room.Logger().Info("Handing off ownership", "player", newOwner.Name)
+	h.setRoomOwner(room, newOwner)
+}
+
+// setRoomOwner makes the given player the only owner of the room.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) setRoomOwner(room *models.GameRoom, newOwner *models.Player) {
+	for _, player := range room.Players {
+		player.IsRoomOwner = player == newOwner
+	}
+
+	room.Game.UpdatePlayers()
+	h.sendBans(room)
+}
+
+// watchRoomChanges gives out the free seats of the room, and keeps the
+// lobby up to date, after each action that changes the room.
+func (h *Hub) watchRoomChanges(room *models.GameRoom) {
+	room.AfterAction = func() {
+		if h.getRoom(room.RoomCode) != room {
+			// The room is closing.
+			return
+		}
+
+		h.seatWaitingPlayers(room)
+		h.updateLobby(room)
+	}
+}
+
+// bindClient routes all further messages from the client to the given
+// player and room.
+func (h *Hub) bindClient(
+	client *Client,
+	player *models.Player,
+	room *models.GameRoom,
+) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.playerClients[client] = player
+	client.room = room
+	h.lobby.unsubscribe(client)
+}
+
+// boundPlayer returns the player that the client is bound to in the
+// given room, or nil if it is not bound to that room.
+func (h *Hub) boundPlayer(
+	client *Client,
+	room *models.GameRoom,
+) *models.Player {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if client.room != room {
+		return nil
+	}
+	return h.playerClients[client]
+}
+
+// leaveRoomFirst takes a client that asks to create or join a game out
+// of the room it is still bound to, unless that is the room with the
+// given code. It returns true if it did, in which case next carries on
+// with the request on the old room's goroutine once the client is out.
+func (h *Hub) leaveRoomFirst(
+	client *Client,
+	roomCode string,
+	next func(),
+) bool {
+	h.mutex.RLock()
+	room := client.room
+	h.mutex.RUnlock()
+	if room == nil || room.RoomCode == roomCode {
+		return false
+	}
+
+	// Once the room is closed, it no longer sends the client anything.
+	return room.Do(func() {
+		if player := h.boundPlayer(client, room); player != nil {
+			h.moveOutOfRoom(room, client, player)
+		}
+		next()
+	})
+}
+
+// unbindClient stops routing messages from the client to its room
+// without closing its connection. The client is left without a room,
+// as if it had just connected, so that it can still join or create
+// one. Clients that already disconnected are not brought back.
+func (h *Hub) unbindClient(client *Client) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
 	if _, ok := h.playerClients[client]; ok {
-		delete(h.playerClients, client)
-		close(client.send)
+		h.playerClients[client] = &models.Player{
+			Client: client,
+		}
+	}
+	client.room = nil
+}
+
+// getRoom returns the room with the given code, or nil.
+func (h *Hub) getRoom(roomCode string) *models.GameRoom {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.rooms[roomCode]
+}
+
+// deleteRoom closes a room right away, letting everyone in it know and
+// disconnecting them. It returns false if there is no such room.
+func (h *Hub) deleteRoom(roomCode string) bool {
+	h.mutex.Lock()
+	room, ok := h.rooms[roomCode]
+	if ok {
+		h.removeRoom(roomCode, time.Now())
+	}
+	h.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	room.Do(func() {
+		for _, players := range [][]*models.Player{
+			room.Players,
+			room.Spectators,
+			waitingPlayers(room),
+		} {
+			for _, player := range players {
+				client, ok := player.Client.(*Client)
+				if !ok {
+					continue
+				}
+
+				h.sendErrorMessage(&models.ErrorMessageRequest{
+					Player: player,
+					Fatal:  true,
+					Error:  "This game has been closed.",
+					Code:   api.ErrorRoomNotFound,
+				})
+				h.unbindClient(client)
+				client.closeSend()
+			}
+		}
+	})
+	h.closeRoom(room)
+	return true
+}
+
+// removeRoom takes a room out of the hub, holding on to its code for a
+// while if the settings say so.
+//
+// This function must be called with the mutex held.
+func (h *Hub) removeRoom(roomCode string, now time.Time) {
+	delete(h.rooms, roomCode)
+	delete(h.roomCreators, roomCode)
+	h.lobby.remove(roomCode)
+	if h.cfg.Rooms.CodeReuseDelay.Duration > 0 {
+		h.freedRoomCodes[roomCode] = now
 	}
 }
 
 func (h *Hub) runRoomCleanup() {
-	for now := range time.Tick(time.Hour) {
+	for now := range time.Tick(h.cfg.Rooms.CleanupInterval.Duration) {
 		h.mutex.Lock()
 
-		roomCodes := []string{}
+		expiredRooms := []*models.GameRoom{}
 		for roomCode, room := range h.rooms {
-			expiryTime := room.LastInteractionTime.Add(
-				time.Hour * time.Duration(1))
+			expiryTime := room.LastInteractionTime().Add(
+				h.cfg.Rooms.Expiry.Duration)
 			if now.After(expiryTime) {
-				roomCodes = append(roomCodes, roomCode)
+				expiredRooms = append(expiredRooms, room)
+				h.removeRoom(roomCode, now)
 			}
 		}
 
-		if len(roomCodes) > 0 {
-			log.Printf("Cleaning up %d old rooms\n", len(roomCodes))
-
-			for _, roomCode := range roomCodes {
-				delete(h.rooms, roomCode)
+		for roomCode, freedAt := range h.freedRoomCodes {
+			if now.Sub(freedAt) >= h.cfg.Rooms.CodeReuseDelay.Duration {
+				delete(h.freedRoomCodes, roomCode)
 			}
 		}
+		h.passwords.prune(now)
 
 		h.mutex.Unlock()
+
+		if len(expiredRooms) > 0 {
+			logging.Info("Cleaning up old rooms", "rooms", len(expiredRooms))
+
+			for _, room := range expiredRooms {
+				h.closeRoom(room)
+			}
+		}
 	}
 }
 
 func (h *Hub) handleIncomingMessage(clientMessage *ClientMessage) {
+	start := time.Now()
+	client := clientMessage.client
+
 	var body json.RawMessage
 	incomingMessage := api.IncomingMessage{
 		Body: &body,
 	}
 	err := json.Unmarshal(clientMessage.message, &incomingMessage)
 	if err != nil {
-		log.Println(err)
+		logging.Info("Could not read message", "ip", client.ip, "error", err)
+		messagesReceived.Inc(noGameTypeLabel, invalidActionLabel)
+		h.sendClientError(client, "", api.ErrorBadRequest,
+			"That message could not be read.")
 		return
 	}
+	requestID := incomingMessage.RequestID
+	if body == nil {
+		// A missing body decodes like an empty one.
+		body = json.RawMessage("null")
+	}
 
-	h.mutex.Lock()
-	player, ok := h.playerClients[clientMessage.client]
+	h.mutex.RLock()
+	player, ok := h.playerClients[client]
+	room := client.room
+	shuttingDown := h.shuttingDown
+	h.mutex.RUnlock()
+	if shuttingDown {
+		// The rooms are stopped, and the client is about to be told
+		// to reconnect.
+		return
+	}
 	if !ok {
-		log.Println("Player client does not exist")
-		h.mutex.Unlock()
+		logging.Warn("Player client does not exist", "ip", client.ip)
+		h.sendClientError(client, requestID, api.ErrorSessionInvalid,
+			"This connection is no longer active, please reconnect.")
 		return
 	}
 
+	gameType, action := messageLabels(room, incomingMessage.Action)
+	messagesReceived.Inc(gameType, action)
+	defer hubHandlerDuration.ObserveSince(start, gameType, action)
+
 	actionType, ok := api.ActionLookup[incomingMessage.Action]
+	if actionType != api.ActionHello &&
+		client.declaredProtocolVersion() == 0 &&
+		legacyProtocolVersion < api.MinProtocolVersion {
+		h.rejectProtocolVersion(client, requestID, legacyProtocolVersion)
+		return
+	}
+
 	if !ok {
-		if player.Room == nil {
-			log.Printf("Invalid action: %s\n", incomingMessage.Action)
-			h.mutex.Unlock()
+		if room == nil {
+			logging.Info("Invalid action", "ip", client.ip,
+				"action", incomingMessage.Action)
+			h.sendClientError(client, requestID, api.ErrorInvalidAction,
+				"That is not a valid action.")
 			return
 		}
 
-		h.mutex.Unlock()
-		player.Room.Game.HandleIncomingMessage(
-			player,
-			incomingMessage,
-			body,
-		)
+		if player.IsSpectator {
+			h.sendClientError(client, requestID, api.ErrorForbidden,
+				"Spectators cannot take part in the game.")
+			return
+		}
+
+		def, _ := models.LookupGame(room.GameType)
+		if !def.HasAction(incomingMessage.Action) {
+			room.Logger().Info("Invalid action", "ip", client.ip,
+				"action", incomingMessage.Action)
+			h.sendClientError(client, requestID, api.ErrorInvalidAction,
+				"That is not a valid action.")
+			return
+		}
+
+		h.doInRoom(client, player, room, requestID, action, func() {
+			if h.rejectIfFaulted(player) || h.rejectIfWaiting(room, player) {
+				return
+			}
+			room.Game.HandleIncomingMessage(
+				player,
+				incomingMessage,
+				body,
+			)
+		})
 		return
 	}
 
-	h.mutex.Unlock()
-
 	switch actionType {
+	case api.ActionHello:
+		var req api.HelloRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.hello(client, requestID, req)
 	case api.ActionCreateGame:
 		var req api.CreateGameRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
 			return
 		}
-		h.createGame(player, req)
+		h.createGame(client, requestID, req)
 	case api.ActionJoinGame:
 		var req api.JoinGameRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
 			return
 		}
-		h.joinGame(player, req)
+		h.joinGame(client, requestID, req)
 	case api.ActionStartGame:
 		var req api.StartGameRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
 			return
 		}
-		h.startGame(player, req)
+		h.doInRoom(client, player, room, requestID, action, func() {
+			if h.rejectIfFaulted(player) {
+				return
+			}
+			h.startGame(player, req)
+		})
 	case api.ActionKickPlayer:
 		var req api.KickPlayerRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.kickPlayer(player, req)
+		})
+	case api.ActionBanPlayer:
+		var req api.BanPlayerRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.banPlayer(player, req)
+		})
+	case api.ActionUnbanPlayer:
+		var req api.UnbanPlayerRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
 		}
-		h.kickPlayer(player, req)
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.unbanPlayer(player, req)
+		})
 	case api.ActionRematch:
 		var req api.RematchRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			log.Println(err)
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.rematch(player, req)
+		})
+	case api.ActionTransferOwnership:
+		var req api.TransferOwnershipRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.transferOwnership(player, req)
+		})
+	case api.ActionSetPassword:
+		var req api.SetPasswordRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.setPassword(player, req)
+		})
+	case api.ActionSetPublic:
+		var req api.SetPublicRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.setPublic(player, req)
+		})
+	case api.ActionSetMaxPlayers:
+		var req api.SetMaxPlayersRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.setMaxPlayers(player, req)
+		})
+	case api.ActionLeaveGame:
+		var req api.LeaveGameRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.leaveGame(room, client, player)
+		})
+	case api.ActionSubscribeLobby:
+		var req api.SubscribeLobbyRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.lobby.subscribe(client)
+	case api.ActionUnsubscribeLobby:
+		var req api.UnsubscribeLobbyRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
+			return
+		}
+		h.lobby.unsubscribe(client)
+	case api.ActionSendChat:
+		var req api.SendChatRequest
+		if err := models.DecodeRequest(body, &req); err != nil {
+			h.rejectRequest(client, requestID, err)
 			return
 		}
-		h.rematch(player, req)
+		h.doInRoom(client, player, room, requestID, action, func() {
+			h.sendChat(player, req)
+		})
 	default:
-		log.Printf("Could not handle incoming action: %s\n",
-			incomingMessage.Action)
+		logging.Warn("Could not handle incoming action", "ip", client.ip,
+			"action", incomingMessage.Action)
+		h.sendClientError(client, requestID, api.ErrorInvalidAction,
+			"That is not a valid action.")
+	}
+}
+
+// doInRoom queues an action on the room's goroutine, or lets the player
+// know if they are not in a room that is still running. The replies to
+// the player while the action runs carry requestID, and the time it
+// takes is recorded under the name of the action.
+func (h *Hub) doInRoom(
+	client *Client,
+	player *models.Player,
+	room *models.GameRoom,
+	requestID string,
+	actionName string,
+	action func(),
+) {
+	if room == nil {
+		h.sendClientError(client, requestID, api.ErrorNotInRoom,
+			"you are not in a game")
+		return
+	}
+
+	if !room.Do(func() {
+		start := time.Now()
+		player.LastSeen = start
+		player.RequestID = requestID
+		player.Action = actionName
+		action()
+		player.RequestID = ""
+		player.Action = ""
+		roomActionDuration.ObserveSince(start, room.GameType, actionName)
+	}) {
+		h.sendClientError(client, requestID, api.ErrorRoomNotFound,
+			"this game no longer exists")
 	}
 }
 
+// rejectRequest lets a client know that the body of its request could
+// not be decoded, or which of its fields are invalid.
+func (h *Hub) rejectRequest(client *Client, requestID string, err error) {
+	logging.Info("Rejecting request", "ip", client.ip,
+		"requestId", requestID, "error", err)
+
+	errorReq := models.NewRequestError(&models.Player{
+		Client:    client,
+		RequestID: requestID,
+	}, err)
+	h.sendErrorMessage(errorReq)
+}
+
+// This function must be called from the room's goroutine.
 func (h *Hub) performRoomChecks(
 	player *models.Player,
 	playerMustBeRoomOwner bool,
@@ -242,23 +797,30 @@ func (h *Hub) performRoomChecks(
 ) (*models.GameRoom, error) {
 	room := player.Room
 	if room == nil {
-		return nil, errors.New("you are not in a game")
+		return nil, models.NewError(api.ErrorNotInRoom,
+			"you are not in a game")
 	}
 
-	if _, ok := h.rooms[room.RoomCode]; !ok {
-		return nil, errors.New("this game no longer exists")
+	h.mutex.RLock()
+	_, ok := h.rooms[room.RoomCode]
+	h.mutex.RUnlock()
+	if !ok {
+		return nil, models.NewError(api.ErrorRoomNotFound,
+			"this game no longer exists")
 	}
 
-	room.LastInteractionTime = time.Now()
+	room.Touch()
 
 	if playerMustBeRoomOwner && !player.IsRoomOwner {
-		return nil, errors.New("you are not the game owner")
+		return nil, models.NewError(api.ErrorNotRoomOwner,
+			"you are not the game owner")
 	}
 	/*
 		if playerMustBeCurrentPlayer {
 			currentPlayer := h.getCurrentPlayer(room)
 			if currentPlayer.name != player.name {
-				return nil, errors.New("you are not the current player")
+				return nil, models.NewError(api.ErrorNotYourTurn,
+					"you are not the current player")
 			}
 		}
 	*/
@@ -266,131 +828,413 @@ func (h *Hub) performRoomChecks(
 }
 
 func (h *Hub) createGame(
-	player *models.Player,
+	client *Client,
+	requestID string,
 	req api.CreateGameRequest,
 ) {
-	log.Printf("Create game request: %s\n", req.Name)
-
-	room := &models.GameRoom{
-		GameType:            req.GameType,
-		RoomCode:            h.generateUniqueRoomCode(),
-		LastInteractionTime: time.Now(),
-		Players:             make([]*models.Player, 0),
+	if h.leaveRoomFirst(client, "", func() {
+		h.createGame(client, requestID, req)
+	}) {
+		return
 	}
-	room.Game = h.newGame(req.GameType, room).(models.Game)
-
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
 
-	h.rooms[room.RoomCode] = room
-	log.Printf("%+v\n", h.rooms)
+	logger := logging.With("ip", client.ip, "player", req.Name,
+		"action", api.Action[api.ActionCreateGame], "requestId", requestID)
+	logger.Info("Create game request", "gameType", req.GameType)
 
-	player.Name = req.Name
-	player.Room = room
-	player.IsRoomOwner = true
-	room.Players = append(room.Players, player)
+	player := &models.Player{
+		Client:       client,
+		SessionToken: util.GenerateToken(),
+		RequestID:    requestID,
+	}
 
-	room.Game.AddPlayer(player)
-}
+	def, ok := models.LookupGame(req.GameType)
+	if !ok {
+		logger.Info("Invalid game type", "gameType", req.GameType)
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That is not a valid game type.",
+			Code:   api.ErrorInvalidGameType,
+		})
+		return
+	}
 
-func (h *Hub) generateUniqueRoomCode() string {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+	h.mutex.Lock()
+	if h.countRoomsCreatedBy(client.ip) >= h.cfg.Rooms.MaxRoomsPerIP {
+		h.mutex.Unlock()
 
-	for {
-		newRoomCode := strconv.Itoa(util.GetRandomNumberInRange(1000, 10000))
-		foundDuplicate := false
-		for roomCode := range h.rooms {
-			if newRoomCode == roomCode {
-				foundDuplicate = true
-				break
-			}
-		}
+		logger.Warn("Too many rooms created")
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "You have created too many games, please try again later.",
+			Code:   api.ErrorTooManyRooms,
+		})
+		return
+	}
+
+	roomCode, err := h.generateUniqueRoomCode()
+	if err != nil {
+		h.mutex.Unlock()
+
+		logger.Error("Could not generate a room code", "rooms", len(h.rooms),
+			"error", err)
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "There are no free room codes right now, please try again later.",
+			Code:   api.ErrorNoRoomCodes,
+		})
+		return
+	}
+
+	room := models.NewGameRoom(roomCode, req.GameType)
+	room.Password = models.NewRoomPassword(req.Password)
+	room.Public = req.Public
+	room.Title = roomTitle(req.Title, req.Name)
+	room.MaxPlayers = req.MaxPlayers
+	room.Game = def.NewGame(room, h.sendOutgoingMessages, h.sendErrorMessage)
+	if err := checkMaxPlayers(room.Game, req.MaxPlayers); err != nil {
+		h.mutex.Unlock()
+
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+	h.watchRoomFaults(room)
+	h.watchRoomChanges(room)
+
+	room.CreatorIP = client.ip
+	h.rooms[room.RoomCode] = room
+	h.roomCreators[room.RoomCode] = client.ip
+	h.playerClients[client] = player
+	client.room = room
+	logger.Info("Created room", "room", room.RoomCode,
+		"gameType", room.GameType, "password", room.Password != nil)
+	h.mutex.Unlock()
 
-		if !foundDuplicate {
-			return newRoomCode
+	go room.Run()
+	room.Do(func() {
+		player.Name = req.Name
+		player.Room = room
+		player.IsRoomOwner = true
+		player.ConnectedAt = time.Now()
+		player.LastSeen = player.ConnectedAt
+		room.Players = append(room.Players, player)
+
+		room.Game.AddPlayer(player)
+		h.sendSessionEvent(player)
+		player.RequestID = ""
+	})
+}
+
+// This function must be called with the mutex held.
+func (h *Hub) countRoomsCreatedBy(ip string) int {
+	count := 0
+	for _, creatorIP := range h.roomCreators {
+		if creatorIP == ip {
+			count++
 		}
 	}
+	return count
 }
 
-func (h *Hub) joinGame(player *models.Player, req api.JoinGameRequest) {
-	log.Printf("Join game request: %s for %s\n", req.Name, req.RoomCode)
+// generateUniqueRoomCode returns a code that no room has, and that was
+// not freed too recently. It returns an error if every code is taken.
+//
+// This function must be called with the mutex held.
+func (h *Hub) generateUniqueRoomCode() (string, error) {
+	now := time.Now()
+	return roomcode.Generate(h.roomCodes, func(roomCode string) bool {
+		if _, ok := h.rooms[roomCode]; ok {
+			return true
+		}
+		freedAt, ok := h.freedRoomCodes[roomCode]
+		return ok && now.Sub(freedAt) < h.cfg.Rooms.CodeReuseDelay.Duration
+	})
+}
 
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+func (h *Hub) joinGame(
+	client *Client,
+	requestID string,
+	req api.JoinGameRequest,
+) {
+	roomCode := roomcode.Normalize(req.RoomCode)
+	if h.leaveRoomFirst(client, roomCode, func() {
+		h.joinGame(client, requestID, req)
+	}) {
+		return
+	}
+
+	logging.Info("Join game request", "ip", client.ip, "room", req.RoomCode,
+		"player", req.Name, "action", api.Action[api.ActionJoinGame],
+		"requestId", requestID, "spectator", req.Spectator)
+
+	player := &models.Player{
+		Client:       client,
+		SessionToken: util.GenerateToken(),
+		RequestID:    requestID,
+	}
+
+	h.mutex.RLock()
+	room, ok := h.rooms[roomCode]
+	h.mutex.RUnlock()
+
+	if ok && req.Spectator {
+		ok = room.Do(func() {
+			if current := h.boundPlayer(client, room); current != nil {
+				h.moveOutOfRoom(room, client, current)
+			}
+			if h.rejectIfBanned(room, client, player, req.SessionToken, false) ||
+				!h.checkRoomPassword(room, client, player, req.Password) {
+				return
+			}
+			if roomMember(room, req.Name) != nil {
+				h.sendErrorMessage(&models.ErrorMessageRequest{
+					Player: player,
+					Error:  "That name is already taken in this room.",
+					Code:   api.ErrorNameTaken,
+				})
+				return
+			}
+			h.spectateGame(room, client, player, req)
+		})
+	} else if ok {
+		ok = room.Do(func() {
+			// Players taking back their seats are not held to the
+			// password, nor to its lockout.
+			matchedPlayer, playerIdx := h.getPlayerInRoom(room, req.Name)
+			current := h.boundPlayer(client, room)
+			if current != nil && current != matchedPlayer {
+				h.moveOutOfRoom(room, client, current)
+			}
+			if matchedPlayer != nil &&
+				sessionTokenMatches(matchedPlayer, req.SessionToken) {
+				matchedPlayer.RequestID = requestID
+				matchedPlayer.Action = api.Action[api.ActionJoinGame]
+				h.rejoinGame(room, client, matchedPlayer, playerIdx,
+					req.LastSeq)
+				matchedPlayer.RequestID = ""
+				matchedPlayer.Action = ""
+				return
+			}
+
+			// Players who still have their seat are not turned away by a
+			// ban on someone who shares their IP address.
+			if h.rejectIfBanned(room, client, player, req.SessionToken, false) {
+				return
+			}
+
+			// Only players who know the password learn which names are
+			// taken.
+			if !h.checkRoomPassword(room, client, player, req.Password) {
+				return
+			}
+
+			if matchedPlayer != nil {
+				var errorMessage string
+				if matchedPlayer.IsConnected() {
+					errorMessage = "That name is already taken by a player in this room."
+				} else {
+					errorMessage = "That name belongs to a player who is away. " +
+						"Rejoin from their device or choose another name."
+				}
+				h.sendErrorMessage(&models.ErrorMessageRequest{
+					Player: player,
+					Error:  errorMessage,
+					Code:   api.ErrorNameTaken,
+				})
+				return
+			}
+			if roomMember(room, req.Name) != nil {
+				// Taken by a spectator or a player waiting to join.
+				h.sendErrorMessage(&models.ErrorMessageRequest{
+					Player: player,
+					Error:  "That name is already taken in this room.",
+					Code:   api.ErrorNameTaken,
+				})
+				return
+			}
+
+			// Players who came before get their seats first.
+			if len(room.Waitlist) > 0 || roomIsFull(room) ||
+				room.Game.State() != "waiting-room" {
+				h.addToWaitlist(room, client, player, req)
+			} else {
+				h.seatPlayer(room, client, player, req)
+			}
+			player.RequestID = ""
+		})
+	}
 
-	room, ok := h.rooms[req.RoomCode]
 	if !ok {
 		h.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  "This room code does not exist.",
+			Code:   api.ErrorRoomNotFound,
 		})
-		return
-	}
-
-	matchedPlayer, playerIdx := h.getPlayerInRoom(room, req.Name)
-	if matchedPlayer != nil {
-		h.rejoinGame(room, player.Client.(*Client), matchedPlayer, playerIdx)
-		return
 	}
+}
 
+// seatPlayer gives a new player a seat in the room, unless the game
+// does not let them in. It returns whether the player was seated.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) seatPlayer(
+	room *models.GameRoom,
+	client *Client,
+	player *models.Player,
+	req api.JoinGameRequest,
+) bool {
+	player.ConnectedAt = time.Now()
+	player.LastSeen = player.ConnectedAt
 	room.Players = append(room.Players, player)
 	room.Game.Join(player, true, req)
+	if player.Room != room {
+		// The game did not let the player in.
+		room.Players = room.Players[:len(room.Players)-1]
+		return false
+	}
+
+	h.bindClient(client, player, room)
+	h.sendSessionEvent(player)
+	h.sendChatHistory(room, player)
+	return true
+}
+
+// spectateGame attaches a client to a room without giving it a seat.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) spectateGame(
+	room *models.GameRoom,
+	client *Client,
+	spectator *models.Player,
+	req api.JoinGameRequest,
+) {
+	spectator.Name = req.Name
+	spectator.Room = room
+	spectator.IsSpectator = true
+	spectator.ConnectedAt = time.Now()
+	spectator.LastSeen = spectator.ConnectedAt
+	room.Spectators = append(room.Spectators, spectator)
+
+	h.bindClient(client, spectator, room)
+	room.Game.UpdatePlayers()
+	h.sendSessionEvent(spectator)
+	h.sendChatHistory(room, spectator)
+	spectator.RequestID = ""
+}
+
+// This function must be called from the room's goroutine.
+func (h *Hub) removeSpectator(
+	room *models.GameRoom,
+	spectator *models.Player,
+) {
+	for idx, s := range room.Spectators {
+		if s == spectator {
+			room.Spectators = append(room.Spectators[:idx],
+				room.Spectators[idx+1:]...)
+			return
+		}
+	}
 }
 
+// rejoinGame attaches a new client to an existing player. If the
+// client has told us the last message it received, it is only sent the
+// messages it missed when they are still kept.
+//
+// This function must be called from the room's goroutine.
 func (h *Hub) rejoinGame(
 	room *models.GameRoom,
 	playerClient *Client,
 	matchedPlayer *models.Player,
 	matchedPlayerIdxInRoom int,
+	lastSeq uint64,
 ) {
-	log.Printf("Found existing player with name %s in room %s\n", matchedPlayer.Name, room.RoomCode)
+	matchedPlayer.Logger().Info("Found existing player")
 
-	matchedPlayerClient := matchedPlayer.Client.(*Client)
-
-	playerAddr := matchedPlayerClient.conn.RemoteAddr().(*net.TCPAddr)
-	reqAddr := playerClient.conn.RemoteAddr().(*net.TCPAddr)
-
-	if reqAddr.IP.String() != playerAddr.IP.String() {
-		log.Printf("Client with IP %s rejoining with same name as client with IP %s\n",
-			reqAddr.IP.String(), playerAddr.IP.String())
-		/*
-			h.sendErrorMessage(&models.ErrorMessageRequest{
-				Player: player,
-				Error: "A player with that name is already in the room.",
-			})
-			return
-		*/
-	}
-
-	if matchedPlayerClient != playerClient {
+	// The matched player has no client if they have not reconnected
+	// since the room was restored.
+	matchedPlayerClient, _ := matchedPlayer.Client.(*Client)
+	if matchedPlayerClient != nil && matchedPlayerClient != playerClient {
 		matchedPlayerClient.conn.Close()
-		delete(h.playerClients, matchedPlayerClient)
-		matchedPlayer.Client = playerClient
+		h.unbindClient(matchedPlayerClient)
 	}
+	matchedPlayer.Client = playerClient
+	if !matchedPlayer.IsConnected() {
+		matchedPlayer.ConnectedAt = time.Now()
+	}
+	matchedPlayer.LastSeen = time.Now()
 
-	h.playerClients[playerClient] = matchedPlayer
+	h.bindClient(playerClient, matchedPlayer, room)
 	room.Players[matchedPlayerIdxInRoom] = matchedPlayer
+
+	// The missed messages must go out before anything new.
+	resumed := h.resumePlayer(matchedPlayer, lastSeq)
+	h.sendPresenceEvent(room, matchedPlayer)
+	if resumed {
+		return
+	}
+
 	room.Game.Join(matchedPlayer, false, api.JoinGameRequest{
 		RoomCode: room.RoomCode,
 		Name:     matchedPlayer.Name,
 	})
+	h.sendChatHistory(room, matchedPlayer)
+	if matchedPlayer.IsRoomOwner && len(room.Bans) > 0 {
+		h.sendBans(room)
+	}
+}
+
+// resumePlayer sends a player the messages they missed after lastSeq,
+// and returns false if they need a full resync instead.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) resumePlayer(player *models.Player, lastSeq uint64) bool {
+	if lastSeq == 0 {
+		// The client is not keeping track of sequence numbers.
+		return false
+	}
+
+	client := player.Client.(*Client)
+	missedMessages, ok := player.Replay.Since(lastSeq)
+	player.Logger().Info("Resuming player", "lastSeq", lastSeq,
+		"fullResync", !ok)
+
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventResumed]
+	msg.RequestID = player.RequestID
+	msg.Body = api.ResumedEvent{
+		LastSeq:    lastSeq,
+		FullResync: !ok,
+	}
+	output, err := json.Marshal(msg)
+	if err != nil {
+		player.Logger().Error("Could not marshal message", "error", err)
+		return false
+	}
+	client.trySend(output)
+
+	for _, missedMessage := range missedMessages {
+		client.trySend(missedMessage)
+	}
+	return ok
 }
 
+// This function must be called from the room's goroutine.
 func (h *Hub) startGame(
 	player *models.Player,
 	req api.StartGameRequest,
 ) {
-	log.Printf("Start game request\n")
-
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+	player.Logger().Info("Start game request")
 
 	room, err := h.performRoomChecks(player, true, false)
 	if err != nil {
 		h.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
@@ -398,122 +1242,400 @@ func (h *Hub) startGame(
 	room.Game.Start(player)
 }
 
+// This function must be called from the room's goroutine.
 func (h *Hub) kickPlayer(
 	player *models.Player,
 	req api.KickPlayerRequest,
 ) {
-	log.Printf("Kick player request: %s\n", req.PlayerName)
-
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+	player.Logger().Info("Kick player request", "kicked", req.PlayerName,
+		"reason", req.Reason)
 
 	room, err := h.performRoomChecks(player, true, false)
 	if err != nil {
 		h.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
 
-	for idx, player := range room.Players {
-		if player.Name == req.PlayerName {
-			room.Players = append(room.Players[:idx], room.Players[idx+1:]...)
-			break
+	if req.PlayerName == player.Name {
+		err = models.NewError(api.ErrorInvalidRequest, "You cannot kick yourself.")
+	} else {
+		err = h.removeFromRoom(room, req.PlayerName, api.ErrorKicked, req.Reason)
+	}
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+	}
+}
+
+// removeFromRoom removes a player, spectator or waiting player from the
+// room, lets them know why with a fatal error with the given code, and
+// closes their connection. It returns an error if nobody in the room
+// has the given name, or if they are seated in a game in progress.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) removeFromRoom(
+	room *models.GameRoom,
+	name string,
+	code api.ErrorCodeT,
+	reason string,
+) error {
+	if idx := waitingPlayerIdx(room, name); idx != -1 {
+		room.Logger().Info("Closing connection for kicked waiting player",
+			"player", name, "reason", reason)
+
+		waiting := room.Waitlist[idx].Player
+		h.removeFromWaitlist(room, waiting)
+		h.disconnectRemoved(waiting, code, reason)
+		return nil
+	}
+
+	for _, spectator := range room.Spectators {
+		if spectator.Name == name {
+			room.Logger().Info("Closing connection for kicked spectator",
+				"player", name, "reason", reason)
+
+			h.removeSpectator(room, spectator)
+			h.disconnectRemoved(spectator, code, reason)
+
+			room.Game.UpdatePlayers()
+			return nil
 		}
 	}
 
-	for client, player := range h.playerClients {
-		if player.Name == req.PlayerName {
-			log.Printf("Closing connection for kicked player: %s\n",
-				req.PlayerName)
+	for idx, player := range room.Players {
+		if player.Name == name {
+			if err := checkLeavable(room, player); err != nil {
+				return err
+			}
+
+			room.Players = append(room.Players[:idx], room.Players[idx+1:]...)
+
+			room.Logger().Info("Closing connection for kicked player",
+				"player", name, "reason", reason)
 
-			delete(h.playerClients, client)
-			client.conn.Close()
-			break
+			h.disconnectRemoved(player, code, reason)
+
+			// Only the admin API can remove the owner, who hands the
+			// room to the next player.
+			wasRoomOwner := player.IsRoomOwner
+			room.Game.Kick(name)
+			if wasRoomOwner && len(room.Players) > 0 {
+				h.setRoomOwner(room, room.Players[0])
+			}
+			return nil
 		}
 	}
 
-	room.Game.Kick(req.PlayerName)
+	return models.NewError(api.ErrorInvalidRequest,
+		"That player is not in the game.")
 }
 
+// This function must be called from the room's goroutine.
 func (h *Hub) rematch(
 	player *models.Player,
 	req api.RematchRequest,
 ) {
-	log.Printf("Rematch request\n")
-
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+	player.Logger().Info("Rematch request")
 
 	room, err := h.performRoomChecks(player, true, false)
 	if err != nil {
 		h.sendErrorMessage(&models.ErrorMessageRequest{
 			Player: player,
 			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
 		})
 		return
 	}
 
+	if room.Fault != nil {
+		h.resetRoom(room)
+		return
+	}
 	room.Game.Rematch(player)
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
+func (h *Hub) transferOwnership(
+	player *models.Player,
+	req api.TransferOwnershipRequest,
+) {
+	player.Logger().Info("Transfer ownership request",
+		"newOwner", req.PlayerName)
+
+	room, err := h.performRoomChecks(player, true, false)
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	newOwner, _ := h.getPlayerInRoom(room, req.PlayerName)
+	if newOwner == nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "That player is not in this game.",
+			Code:   api.ErrorInvalidRequest,
+		})
+		return
+	}
+
+	h.setRoomOwner(room, newOwner)
+}
+
+// This function must be called from the room's goroutine.
+func (h *Hub) setPassword(
+	player *models.Player,
+	req api.SetPasswordRequest,
+) {
+	player.Logger().Info("Set password request",
+		"password", req.Password != "")
+
+	room, err := h.performRoomChecks(player, true, false)
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	room.Password = models.NewRoomPassword(req.Password)
+
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventUpdatedPassword]
+	msg.Body = api.UpdatedPasswordEvent{
+		HasPassword: room.Password != nil,
+	}
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		SecondaryMsg: &msg,
+		Room:         room,
+	})
+}
+
+// sendErrorMessage sends an error to a player, echoing the ID of the
+// request the room is handling for them. Unless the player has not
+// joined a room yet, this function must be called from the room's
+// goroutine.
 func (h *Hub) sendErrorMessage(req *models.ErrorMessageRequest) {
 	var msg api.OutgoingMessage
 	msg.Event = "error"
+	msg.RequestID = req.Player.RequestID
 	msg.ErrorIsFatal = req.Fatal
 	msg.Error = req.Error
+	msg.ErrorCode = api.ErrorCode[req.Code]
+	msg.Body = req.Body
 	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
 		PrimaryClient: req.Player.Client,
 		PrimaryMsg:    &msg,
 	})
 }
 
-// This function must be called with the mutex held.
+// sendClientError sends an error to a client from the hub's goroutine,
+// which must not touch the players of any room.
+func (h *Hub) sendClientError(
+	client *Client,
+	requestID string,
+	code api.ErrorCodeT,
+	error string,
+) {
+	var msg api.OutgoingMessage
+	msg.Event = "error"
+	msg.RequestID = requestID
+	msg.Error = error
+	msg.ErrorCode = api.ErrorCode[code]
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		PrimaryClient: client,
+		PrimaryMsg:    &msg,
+	})
+}
+
+// sendOutgoingMessages sends the messages of req. The messages to the
+// players and spectators of req.Room are numbered and kept for each of
+// them, and echo the ID of the request the room is handling for them.
+// Messages outside of a room, such as most errors, are not numbered.
+//
+// If req.Room is set, this function must be called from its goroutine.
 func (h *Hub) sendOutgoingMessages(
 	req *models.OutgoingMessageRequest,
 ) {
-	var primaryOutput []byte
-	var err error
-	if req.PrimaryMsg != nil {
-		primaryOutput, err = json.Marshal(*req.PrimaryMsg)
-		if err != nil {
-			log.Println(err)
-			return
+	primaryClient, _ := req.PrimaryClient.(*Client)
+	sentPrimaryMsg := false
+
+	if req.Room != nil {
+		for _, players := range [][]*models.Player{
+			req.Room.Players,
+			req.Room.Spectators,
+		} {
+			for _, player := range players {
+				msg := req.SecondaryMsg
+				if req.PrimaryMsg != nil && primaryClient != nil &&
+					player.Client == primaryClient {
+					msg = req.PrimaryMsg
+					sentPrimaryMsg = true
+				}
+
+				if msg != nil {
+					h.sendToPlayer(player, msg)
+				}
+			}
 		}
 	}
 
-	var secondaryOutput []byte
-	if req.SecondaryMsg != nil {
-		secondaryOutput, err = json.Marshal(req.SecondaryMsg)
+	if req.PrimaryMsg != nil && primaryClient != nil && !sentPrimaryMsg {
+		output, err := json.Marshal(req.PrimaryMsg)
 		if err != nil {
-			log.Println(err)
+			logging.Error("Could not marshal message", "error", err)
 			return
 		}
+		primaryClient.trySend(output)
 	}
+}
 
-	for client := range h.playerClients {
-		if primaryOutput != nil && client == req.PrimaryClient {
-			select {
-			case client.send <- primaryOutput:
-			default:
-				close(client.send)
-				delete(h.playerClients, client)
-			}
-		} else if req.SecondaryMsg != nil &&
-			(req.Room == nil || h.playerClients[client].Room == req.Room) {
-			select {
-			case client.send <- secondaryOutput:
-			default:
-				close(client.send)
-				delete(h.playerClients, client)
-			}
-		}
+// sendToPlayer numbers a message for a player, keeps it for replaying
+// and sends it to their client.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) sendToPlayer(player *models.Player, msg *api.OutgoingMessage) {
+	numberedMsg := *msg
+	numberedMsg.Seq = player.Replay.NextSeq()
+	if numberedMsg.RequestID == "" {
+		numberedMsg.RequestID = player.RequestID
+	}
+
+	output, err := json.Marshal(numberedMsg)
+	if err != nil {
+		player.Logger().Error("Could not marshal message", "error", err)
+		return
+	}
+
+	client, ok := player.Client.(*Client)
+	if !ok {
+		// Without a client to compare against, messages meant only for
+		// this player cannot be told apart, so nothing can be replayed.
+		player.Replay.Reset(player.Replay.LastSeq())
+		return
 	}
+
+	player.Replay.Add(output)
+	client.trySend(output)
 }
 
-// This function must be called with the mutex held.
+// This function must be called from the room's goroutine.
+func (h *Hub) sendSessionEvent(player *models.Player) {
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventSession]
+	msg.Body = api.SessionEvent{
+		RoomCode:     player.Room.RoomCode,
+		Name:         player.Name,
+		SessionToken: player.SessionToken,
+		HasPassword:  player.Room.Password != nil,
+	}
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		PrimaryClient: player.Client,
+		PrimaryMsg:    &msg,
+		Room:          player.Room,
+	})
+}
+
+// sendPresenceEvent lets everyone in the room know whether a player is
+// connected.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) sendPresenceEvent(room *models.GameRoom, player *models.Player) {
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventUpdatedPresence]
+	msg.Body = api.UpdatedPresenceEvent{
+		PlayerName: player.Name,
+		Connected:  player.IsConnected(),
+		LastSeen:   player.LastSeen.UnixNano() / 1000000,
+	}
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		SecondaryMsg: &msg,
+		Room:         room,
+	})
+}
+
+// sendNotice sends a message from the server operators to everyone in
+// the room.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) sendNotice(room *models.GameRoom, message string) {
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventNotice]
+	msg.Body = api.NoticeEvent{
+		Message: message,
+	}
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		SecondaryMsg: &msg,
+		Room:         room,
+	})
+}
+
+// sessionTokenMatches returns whether a client presented the secret
+// session token of a player.
+func sessionTokenMatches(player *models.Player, sessionToken string) bool {
+	return sessionToken != "" && subtle.ConstantTimeCompare(
+		[]byte(player.SessionToken), []byte(sessionToken)) == 1
+}
+
+// checkRoomPassword returns whether a client that is not taking back
+// its seat may join the room, and lets it know if it may not. Wrong
+// passwords count towards the lockout of the client's IP address, which
+// only ever stops clients from trying passwords.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) checkRoomPassword(
+	room *models.GameRoom,
+	client *Client,
+	player *models.Player,
+	password string,
+) bool {
+	if room.Password == nil {
+		return true
+	}
+	if h.passwords.locked(client.ip, time.Now()) {
+		room.Logger().Warn("Locked out of room", "ip", client.ip)
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  "Too many wrong passwords were tried, please try again later.",
+			Code:   api.ErrorPasswordLocked,
+		})
+		return false
+	}
+
+	if room.Password.Matches(password) {
+		h.passwords.succeed(client.ip)
+		return true
+	}
+
+	locked := h.passwords.fail(client.ip, time.Now())
+	room.Logger().Info("Wrong room password", "ip", client.ip,
+		"player", player.Name, "locked", locked)
+
+	errorMessage := "That password is not right."
+	if password == "" {
+		errorMessage = "This room needs a password."
+	}
+	h.sendErrorMessage(&models.ErrorMessageRequest{
+		Player: player,
+		Error:  errorMessage,
+		Code:   api.ErrorWrongPassword,
+	})
+	return false
+}
+
+// This function must be called from the room's goroutine.
 func (h *Hub) getPlayerInRoom(
 	room *models.GameRoom,
 	name string,
@@ -526,3 +1648,24 @@ func (h *Hub) getPlayerInRoom(
 
 	return nil, -1
 }
+
+// roomMember returns the player, spectator or waiting player in the room
+// with the given name, or nil.
+//
+// This function must be called from the room's goroutine.
+func roomMember(room *models.GameRoom, name string) *models.Player {
+	for _, player := range room.Players {
+		if player.Name == name {
+			return player
+		}
+	}
+	for _, spectator := range room.Spectators {
+		if spectator.Name == name {
+			return spectator
+		}
+	}
+	if idx := waitingPlayerIdx(room, name); idx != -1 {
+		return room.Waitlist[idx].Player
+	}
+	return nil
+}
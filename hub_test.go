@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sndurkin/game-night-in/api"
+)
+
+func TestPasswordLockout(t *testing.T) {
+	const sharedIP = "203.0.113.5"
+
+	tests := []struct {
+		name string
+		// Has a new client from the locked out address join the room,
+		// given the session token of Bob, who is seated.
+		join      func(h *Hub, client *Client, token string)
+		wantBob   bool
+		wantCodes []string
+	}{
+		{
+			name: "rejoin with a session token",
+			join: func(h *Hub, client *Client, token string) {
+				h.joinGame(client, "", api.JoinGameRequest{
+					RoomCode:     client.roomCode,
+					Name:         "Bob",
+					SessionToken: token,
+				})
+			},
+			wantBob: true,
+		},
+		{
+			name: "reconnect with a session token",
+			join: func(h *Hub, client *Client, token string) {
+				client.playerName = "Bob"
+				client.sessionToken = token
+				h.registerClient(client)
+			},
+			wantBob: true,
+		},
+		{
+			name: "join with the right password",
+			join: func(h *Hub, client *Client, token string) {
+				h.joinGame(client, "", api.JoinGameRequest{
+					RoomCode: client.roomCode,
+					Name:     "Cy",
+					Password: "secret",
+				})
+			},
+			wantCodes: []string{api.ErrorCode[api.ErrorPasswordLocked]},
+		},
+		{
+			name: "spectate with the right password",
+			join: func(h *Hub, client *Client, token string) {
+				h.joinGame(client, "", api.JoinGameRequest{
+					RoomCode:  client.roomCode,
+					Name:      "Cy",
+					Password:  "secret",
+					Spectator: true,
+				})
+			},
+			wantCodes: []string{api.ErrorCode[api.ErrorPasswordLocked]},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newTestHub()
+			room := createTestRoom(t, h, newTestClient(t, h, "198.51.100.1"),
+				api.CreateGameRequest{
+					GameType: "fishbowl",
+					Name:     "Ada",
+					Password: "secret",
+				})
+			joinTestRoom(t, h, newTestClient(t, h, sharedIP), room,
+				api.JoinGameRequest{Name: "Bob", Password: "secret"})
+
+			var token string
+			inTestRoom(t, room, func() {
+				bob, _ := h.getPlayerInRoom(room, "Bob")
+				token = bob.SessionToken
+			})
+
+			// Someone else on the same network guesses the password.
+			for i := 0; i < h.cfg.Rooms.PasswordAttempts; i++ {
+				h.passwords.fail(sharedIP, time.Now())
+			}
+
+			client := newTestClient(t, h, sharedIP)
+			client.roomCode = room.RoomCode
+			test.join(h, client, token)
+			inTestRoom(t, room, func() {
+				bob, _ := h.getPlayerInRoom(room, "Bob")
+				if isBob := bob.Client == client; isBob != test.wantBob {
+					t.Errorf("client took Bob's seat = %v, want %v", isBob,
+						test.wantBob)
+				}
+			})
+
+			if codes := takeErrorCodes(t, client); !reflect.DeepEqual(codes,
+				test.wantCodes) {
+				t.Errorf("client was sent errors %v, want %v", codes,
+					test.wantCodes)
+			}
+		})
+	}
+}
+
+func TestConcurrentJoins(t *testing.T) {
+	const joiners = 20
+
+	h := newTestHub()
+	room := createTestRoom(t, h, newTestClient(t, h, "192.0.2.1"),
+		api.CreateGameRequest{GameType: "fishbowl", Name: "Ada"})
+
+	clients := make([]*Client, joiners)
+	for idx := range clients {
+		clients[idx] = newTestClient(t, h, fmt.Sprintf("192.0.2.%d", idx+2))
+	}
+
+	// The room takes the requests one at a time, in whatever order they
+	// come in.
+	var wg sync.WaitGroup
+	for idx, client := range clients {
+		idx, client := idx, client
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.joinGame(client, "", api.JoinGameRequest{
+				RoomCode: room.RoomCode,
+				Name:     fmt.Sprintf("Player %d", idx),
+			})
+		}()
+	}
+	wg.Wait()
+
+	inTestRoom(t, room, func() {
+		if len(room.Players) != joiners+1 {
+			t.Fatalf("room has %d players, want %d", len(room.Players),
+				joiners+1)
+		}
+		for idx, client := range clients {
+			player, _ := h.getPlayerInRoom(room, fmt.Sprintf("Player %d", idx))
+			if player == nil || player.Client != client {
+				t.Errorf("Player %d is not seated with their client", idx)
+			}
+		}
+	})
+}
+
+func TestSessionTokenRejoin(t *testing.T) {
+	nameTaken := []string{api.ErrorCode[api.ErrorNameTaken]}
+	sessionInvalid := []string{api.ErrorCode[api.ErrorSessionInvalid]}
+	joinAsBob := func(h *Hub, client *Client, token string) {
+		h.joinGame(client, "", api.JoinGameRequest{
+			RoomCode:     client.roomCode,
+			Name:         "Bob",
+			SessionToken: token,
+		})
+	}
+	reconnectAsBob := func(h *Hub, client *Client, token string) {
+		client.playerName = "Bob"
+		client.sessionToken = token
+		h.registerClient(client)
+	}
+
+	tests := []struct {
+		name    string
+		bobAway bool
+		// Which session token the new client presents: Bob's, Ada's,
+		// a made up one or none.
+		token     string
+		join      func(h *Hub, client *Client, token string)
+		wantBob   bool
+		wantCodes []string
+	}{
+		{
+			name:    "join with Bob's token",
+			token:   "Bob",
+			join:    joinAsBob,
+			wantBob: true,
+		},
+		{
+			name:    "join with Bob's token while Bob is away",
+			bobAway: true,
+			token:   "Bob",
+			join:    joinAsBob,
+			wantBob: true,
+		},
+		{
+			name:      "join with another player's token",
+			token:     "Ada",
+			join:      joinAsBob,
+			wantCodes: nameTaken,
+		},
+		{
+			name:      "join with a made up token",
+			token:     "made up",
+			join:      joinAsBob,
+			wantCodes: nameTaken,
+		},
+		{
+			name:      "join with a made up token while Bob is away",
+			bobAway:   true,
+			token:     "made up",
+			join:      joinAsBob,
+			wantCodes: nameTaken,
+		},
+		{
+			name:      "join without a token",
+			join:      joinAsBob,
+			wantCodes: nameTaken,
+		},
+		{
+			name:    "reconnect with Bob's token",
+			token:   "Bob",
+			join:    reconnectAsBob,
+			wantBob: true,
+		},
+		{
+			name:      "reconnect with a made up token",
+			bobAway:   true,
+			token:     "made up",
+			join:      reconnectAsBob,
+			wantCodes: sessionInvalid,
+		},
+		{
+			name:      "reconnect without a token",
+			bobAway:   true,
+			join:      reconnectAsBob,
+			wantCodes: sessionInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newTestHub()
+			room := createTestRoom(t, h, newTestClient(t, h, "192.0.2.1"),
+				api.CreateGameRequest{GameType: "fishbowl", Name: "Ada"})
+			bobClient := newTestClient(t, h, "192.0.2.2")
+			joinTestRoom(t, h, bobClient, room, api.JoinGameRequest{Name: "Bob"})
+			if test.bobAway {
+				h.unregisterClient(bobClient)
+			}
+
+			tokens := map[string]string{"made up": "made up"}
+			inTestRoom(t, room, func() {
+				for _, player := range room.Players {
+					tokens[player.Name] = player.SessionToken
+				}
+			})
+
+			client := newTestClient(t, h, "198.51.100.1")
+			client.roomCode = room.RoomCode
+			test.join(h, client, tokens[test.token])
+			inTestRoom(t, room, func() {
+				if len(room.Players) != 2 {
+					t.Errorf("room has %d players, want 2", len(room.Players))
+				}
+				bob, _ := h.getPlayerInRoom(room, "Bob")
+				if isBob := bob.Client == client; isBob != test.wantBob {
+					t.Errorf("client took Bob's seat = %v, want %v", isBob,
+						test.wantBob)
+				}
+				if test.wantBob && !bob.IsConnected() {
+					t.Error("Bob is not connected after taking the seat back")
+				}
+			})
+
+			if codes := takeErrorCodes(t, client); !reflect.DeepEqual(codes,
+				test.wantCodes) {
+				t.Errorf("client was sent errors %v, want %v", codes,
+					test.wantCodes)
+			}
+			h.mutex.RLock()
+			oldRoom := bobClient.room
+			h.mutex.RUnlock()
+			if oldBound := oldRoom != nil; oldBound == test.wantBob {
+				t.Errorf("Bob's old client bound to the room = %v, want %v",
+					oldBound, !test.wantBob)
+			}
+		})
+	}
+}
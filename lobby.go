@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/logging"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// lobby holds the public rooms, and the clients that are kept up to
+// date with them. It is used from the hub's goroutine and from the
+// goroutines of the rooms. Its mutex may be taken while the hub mutex
+// is held, but not the other way around.
+type lobby struct {
+	mutex       sync.Mutex
+	rooms       map[string]api.LobbyRoom
+	subscribers map[*Client]bool
+}
+
+func newLobby() *lobby {
+	return &lobby{
+		rooms:       make(map[string]api.LobbyRoom),
+		subscribers: make(map[*Client]bool),
+	}
+}
+
+// list returns the public rooms, in the order of their titles.
+//
+// This function must be called with the lobby mutex held.
+func (l *lobby) list() []api.LobbyRoom {
+	rooms := make([]api.LobbyRoom, 0, len(l.rooms))
+	for _, room := range l.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].Title != rooms[j].Title {
+			return rooms[i].Title < rooms[j].Title
+		}
+		return rooms[i].RoomCode < rooms[j].RoomCode
+	})
+	return rooms
+}
+
+// send sends the public rooms to the given clients. The clients are
+// sent every update while the mutex is held, so they see them in
+// order.
+//
+// This function must be called with the lobby mutex held.
+func (l *lobby) send(clients map[*Client]bool) {
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventUpdatedLobby]
+	msg.Body = api.UpdatedLobbyEvent{
+		Rooms: l.list(),
+	}
+	output, err := json.Marshal(msg)
+	if err != nil {
+		logging.Error("Could not marshal message", "error", err)
+		return
+	}
+
+	for client := range clients {
+		client.trySend(output)
+	}
+}
+
+// set lists a room, or changes how it is listed, and lets the
+// subscribers know if anything changed.
+func (l *lobby) set(room api.LobbyRoom) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.rooms[room.RoomCode] == room {
+		return
+	}
+	l.rooms[room.RoomCode] = room
+	l.send(l.subscribers)
+}
+
+// remove takes a room off the list, and lets the subscribers know if it
+// was on it.
+func (l *lobby) remove(roomCode string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, ok := l.rooms[roomCode]; !ok {
+		return
+	}
+	delete(l.rooms, roomCode)
+	l.send(l.subscribers)
+}
+
+// subscribe sends the public rooms to a client, and then every change
+// to them.
+func (l *lobby) subscribe(client *Client) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.subscribers[client] = true
+	l.send(map[*Client]bool{client: true})
+}
+
+func (l *lobby) unsubscribe(client *Client) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.subscribers, client)
+}
+
+// publicRooms returns the public rooms.
+func (l *lobby) publicRooms() []api.LobbyRoom {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.list()
+}
+
+// updateLobby lists the room in the lobby if it is public, or takes it
+// off otherwise. Rooms whose game broke are not listed either. Rooms
+// that have been removed from the hub, and are only finishing their
+// last actions, were already taken off.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) updateLobby(room *models.GameRoom) {
+	// Held until the lobby is updated, so that the room cannot be
+	// removed from the hub, and the lobby, in between.
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if h.rooms[room.RoomCode] != room {
+		return
+	}
+	if !room.Public || room.Fault != nil {
+		h.lobby.remove(room.RoomCode)
+		return
+	}
+
+	h.lobby.set(api.LobbyRoom{
+		RoomCode:    room.RoomCode,
+		Title:       room.Title,
+		GameType:    room.GameType,
+		Players:     len(room.Players),
+		MaxPlayers:  roomCapacity(room),
+		Waiting:     len(room.Waitlist),
+		State:       room.Game.State(),
+		HasPassword: room.Password != nil,
+	})
+}
+
+// This function must be called from the room's goroutine.
+func (h *Hub) setPublic(player *models.Player, req api.SetPublicRequest) {
+	player.Logger().Info("Set public request", "public", req.Public,
+		"title", req.Title)
+
+	room, err := h.performRoomChecks(player, true, false)
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	room.Public = req.Public
+	room.Title = roomTitle(req.Title, player.Name)
+}
+
+// roomTitle returns the title that a room is listed under, which is
+// named after its owner unless they gave it one.
+func roomTitle(title string, ownerName string) string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return ownerName + "'s room"
+	}
+	return title
+}
+
+// serveLobby lists the public rooms, for clients that would rather poll
+// than subscribe to the lobby.
+func serveLobby(h *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.lobby.publicRooms())
+}
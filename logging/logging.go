@@ -0,0 +1,283 @@
+// Package logging writes leveled, structured log lines, either in the
+// logfmt format or as JSON objects, one per line.
+//
+// Each line has a time, level and message, followed by the fields of
+// the logger, such as the room and player it is about, and those given
+// with the message. Fields are passed as alternating keys and values:
+//
+//	logger.Info("Move player request", "toTeam", req.ToTeam)
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name, e.g. "info".
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Format is how log lines are written.
+type Format int
+
+const (
+	FormatLogfmt Format = iota
+	FormatJSON
+)
+
+// ParseFormat returns the format with the given name, "logfmt" or
+// "json".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "logfmt":
+		return FormatLogfmt, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return 0, fmt.Errorf("unknown log format %q", name)
+}
+
+var (
+	mutex  sync.Mutex
+	level  = LevelInfo
+	format = FormatLogfmt
+	output = io.Writer(os.Stderr)
+)
+
+// Configure sets the lowest level that is written, and the format.
+func Configure(minLevel Level, lineFormat Format) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	level = minLevel
+	format = lineFormat
+}
+
+// SetOutput sets where log lines are written, which is os.Stderr by
+// default.
+func SetOutput(w io.Writer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	output = w
+}
+
+// Enabled returns whether lines of the given level are written.
+func Enabled(l Level) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return l >= level
+}
+
+// Logger writes log lines with a set of fields. Its zero value has no
+// fields and is ready to use.
+type Logger struct {
+	fields []interface{}
+}
+
+var root = &Logger{}
+
+// With returns a logger with the given fields.
+func With(keyvals ...interface{}) *Logger {
+	return root.With(keyvals...)
+}
+
+// With returns a logger with the fields of l and the given ones.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{fields: fields}
+}
+
+// Debug writes a line about the details of what is going on.
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.write(LevelDebug, msg, keyvals)
+}
+
+// Info writes a line about something that happened.
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.write(LevelInfo, msg, keyvals)
+}
+
+// Warn writes a line about something that went wrong, but was handled.
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.write(LevelWarn, msg, keyvals)
+}
+
+// Error writes a line about something that went wrong.
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.write(LevelError, msg, keyvals)
+}
+
+// Debug writes a line without any logger fields.
+func Debug(msg string, keyvals ...interface{}) {
+	root.write(LevelDebug, msg, keyvals)
+}
+
+// Info writes a line without any logger fields.
+func Info(msg string, keyvals ...interface{}) {
+	root.write(LevelInfo, msg, keyvals)
+}
+
+// Warn writes a line without any logger fields.
+func Warn(msg string, keyvals ...interface{}) {
+	root.write(LevelWarn, msg, keyvals)
+}
+
+// Error writes a line without any logger fields.
+func Error(msg string, keyvals ...interface{}) {
+	root.write(LevelError, msg, keyvals)
+}
+
+func (l *Logger) write(lineLevel Level, msg string, keyvals []interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if lineLevel < level {
+		return
+	}
+
+	fields := []interface{}{
+		"time", time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		"level", lineLevel.String(),
+		"msg", msg,
+	}
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(missing)")
+	}
+
+	var line bytes.Buffer
+	if format == FormatJSON {
+		writeJSON(&line, fields)
+	} else {
+		writeLogfmt(&line, fields)
+	}
+	line.WriteByte('\n')
+	output.Write(line.Bytes())
+}
+
+func writeLogfmt(b *bytes.Buffer, fields []interface{}) {
+	first := true
+	for i := 0; i < len(fields); i += 2 {
+		value, ok := formatValue(fields[i+1])
+		if !ok {
+			continue
+		}
+
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+}
+
+func writeJSON(b *bytes.Buffer, fields []interface{}) {
+	b.WriteByte('{')
+	first := true
+	for i := 0; i < len(fields); i += 2 {
+		value := fields[i+1]
+		if _, ok := formatValue(value); !ok {
+			continue
+		}
+		switch value.(type) {
+		case error, time.Time, time.Duration, fmt.Stringer:
+			value, _ = formatValue(value)
+		}
+
+		if !first {
+			b.WriteByte(',')
+		}
+		first = false
+
+		key, _ := json.Marshal(fmt.Sprint(fields[i]))
+		b.Write(key)
+		b.WriteByte(':')
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			encoded, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.Write(encoded)
+	}
+	b.WriteByte('}')
+}
+
+// formatValue returns the text of a field value, or false if the field
+// has no value and should be left out, e.g. the player of a line about
+// a whole room.
+func formatValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, v != ""
+	case error:
+		return v.Error(), true
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), true
+	case time.Duration:
+		return v.String(), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return fmt.Sprint(value), true
+}
+
+// Writer returns a writer that logs each write as a line with the given
+// level, e.g. for the standard library's log package.
+func Writer(lineLevel Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		root.write(lineLevel, strings.TrimRight(string(p), "\n"), nil)
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
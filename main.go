@@ -5,24 +5,30 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/sndurkin/game-night-in/api"
-	"github.com/sndurkin/game-night-in/fishbowl"
-	"github.com/sndurkin/game-night-in/codenames"
-)
-
-const (
-	defaultPort = "3000"
+	"github.com/sndurkin/game-night-in/config"
+	"github.com/sndurkin/game-night-in/logging"
+	"github.com/sndurkin/game-night-in/models"
+	"github.com/sndurkin/game-night-in/store"
+
+	// Game types register themselves when imported.
+	_ "github.com/sndurkin/game-night-in/codenames"
+	_ "github.com/sndurkin/game-night-in/fishbowl"
 )
 
 func serveHome(w http.ResponseWriter, r *http.Request) {
-	log.Println(r.URL)
 	if r.URL.Path != "/" {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
@@ -34,17 +40,51 @@ func serveHome(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "public/index.html")
 }
 
-func remoteAddr(r *http.Request) string {
-	via := r.RemoteAddr
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		return fmt.Sprintf("%v via %v", xff, r.RemoteAddr)
+// serveGames lists the game types that can be created.
+func serveGames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type gameInfo struct {
+		*models.GameDefinition
+		DefaultSettings interface{} `json:"defaultSettings"`
 	}
-	return via
+
+	games := []gameInfo{}
+	for _, def := range models.RegisteredGames() {
+		games = append(games, gameInfo{
+			GameDefinition:  def,
+			DefaultSettings: def.DefaultSettings(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(games)
 }
 
 func logRequest(r *http.Request) {
-	log.Printf("%v %v %v %v", remoteAddr(r), r.Method, r.URL, r.Proto)
+	logging.Info("HTTP request", "remoteAddr", r.RemoteAddr,
+		"forwardedFor", r.Header.Get("X-Forwarded-For"), "method", r.Method,
+		"url", r.URL, "proto", r.Proto)
+}
+
+// configureLogging sets up the log level and format, and sends the
+// lines of the standard log package, e.g. from net/http, through the
+// same logger. The settings have already been validated.
+func configureLogging(cfg *config.Config) {
+	level, _ := logging.ParseLevel(cfg.Server.LogLevel)
+	format, _ := logging.ParseFormat(cfg.Server.LogFormat)
+	logging.Configure(level, format)
+	log.SetFlags(0)
+	log.SetOutput(logging.Writer(logging.LevelWarn))
+}
+
+// fatal logs an error that keeps the server from running, and exits.
+func fatal(msg string, err error) {
+	logging.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 func logRoute(f http.HandlerFunc) http.HandlerFunc {
@@ -57,20 +97,46 @@ func logRoute(f http.HandlerFunc) http.HandlerFunc {
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"),
+		"path to a JSON file with the settings of the server")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	configureLogging(cfg)
+	logging.Info("Configuration", cfg.Fields()...)
+
 	api.Init()
-	fishbowl.Init()
-	codenames.Init()
+	models.InitGames(cfg)
+
+	roomStore, err := store.NewFileStore(cfg.Server.SnapshotDir)
+	if err != nil {
+		fatal("Could not open the snapshot directory", err)
+	}
 
-	h := newHub()
+	h := newHub(cfg, roomStore)
+	h.restoreRooms()
 	go h.run()
 	go h.runRoomCleanup()
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
-	}
+	go h.runRoomSnapshots()
 
 	http.HandleFunc("/", logRoute(serveHome))
+	http.HandleFunc("/games", logRoute(serveGames))
+	http.HandleFunc("/lobby", logRoute(func(w http.ResponseWriter, r *http.Request) {
+		serveLobby(h, w, r)
+	}))
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		serveMetrics(h, w, r)
+	})
+
+	if cfg.Server.AdminToken != "" {
+		admin := &adminAPI{hub: h, token: cfg.Server.AdminToken}
+		http.Handle("/admin/", logRoute(admin.ServeHTTP))
+	} else {
+		logging.Warn("ADMIN_TOKEN is not set, the admin API is disabled")
+	}
 
 	fs := http.FileServer(http.Dir("./public"))
 	http.Handle("/public/", http.StripPrefix("/public/", fs))
@@ -79,10 +145,36 @@ func main() {
 		serveWs(h, w, r)
 	}))
 
-	addr := fmt.Sprintf(":%s", port)
-	log.Printf("Server listening on %s\n", addr)
-	err := http.ListenAndServe(addr, nil)
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	server := &http.Server{Addr: fmt.Sprintf(":%s", cfg.Server.Port)}
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+
+		logging.Info("Shutting down", "signal", sig)
+		shutdown(server, h)
+		close(stopped)
+	}()
+
+	logging.Info("Server listening", "addr", server.Addr)
+	err = server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		fatal("Could not listen", err)
+	}
+	<-stopped
+}
+
+// shutdown stops accepting connections and lets the requests in
+// progress finish, then shuts down the hub. Websocket connections are
+// not waited for by the server, so the hub closes them itself.
+func shutdown(server *http.Server, h *Hub) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		shutdownCloseTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logging.Warn("Could not finish every request", "error", err)
 	}
+	h.shutdown()
 }
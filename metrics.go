@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/logging"
+	"github.com/sndurkin/game-night-in/metrics"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+const (
+	// Game type of messages from clients that are not in a room.
+	noGameTypeLabel = "none"
+
+	// Action of messages that are not valid, so that made up action
+	// names cannot create any number of metrics.
+	invalidActionLabel = "invalid"
+)
+
+var (
+	roomsGauge = metrics.NewGauge(
+		"gamenight_rooms",
+		"Number of live rooms.",
+		"game_type")
+
+	connectionsGauge = metrics.NewGauge(
+		"gamenight_connections",
+		"Number of open websocket connections.")
+
+	messagesReceived = metrics.NewCounter(
+		"gamenight_messages_received_total",
+		"Number of messages received from clients.",
+		"game_type", "action")
+
+	slowClientDrops = metrics.NewCounter(
+		"gamenight_slow_client_drops_total",
+		"Number of clients disconnected for not reading their messages.")
+
+	hubHandlerDuration = metrics.NewHistogram(
+		"gamenight_hub_handler_duration_seconds",
+		"Time the hub spends routing a message, during which it cannot "+
+			"route any other message.",
+		metrics.DurationBuckets,
+		"game_type", "action")
+
+	roomActionDuration = metrics.NewHistogram(
+		"gamenight_room_action_duration_seconds",
+		"Time a room spends handling an action, during which it cannot "+
+			"handle any other action.",
+		metrics.DurationBuckets,
+		"game_type", "action")
+)
+
+// messageLabels returns the game type and action to record a message
+// from a client in the given room under.
+func messageLabels(room *models.GameRoom, action string) (string, string) {
+	gameType := noGameTypeLabel
+	if room != nil {
+		gameType = room.GameType
+	}
+
+	if _, ok := api.ActionLookup[action]; ok {
+		return gameType, action
+	}
+	if room != nil {
+		if def, ok := models.LookupGame(room.GameType); ok &&
+			def.HasAction(action) {
+			return gameType, action
+		}
+	}
+	return gameType, invalidActionLabel
+}
+
+// serveMetrics writes the metrics of the server in the Prometheus text
+// format.
+func serveMetrics(h *Hub, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	numRooms := make(map[string]int)
+	for _, def := range models.RegisteredGames() {
+		numRooms[def.GameType] = 0
+	}
+	for _, room := range h.getRooms() {
+		numRooms[room.GameType]++
+	}
+	for gameType, n := range numRooms {
+		roomsGauge.Set(float64(n), gameType)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := metrics.WriteText(w); err != nil {
+		logging.Warn("Could not write metrics", "error", err)
+	}
+}
@@ -0,0 +1,268 @@
+// Package metrics keeps counters, gauges and histograms in memory and
+// writes them out in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	registryMutex sync.Mutex
+	registry      []*vec
+)
+
+// vec holds the values of one metric for every combination of label
+// values it has been used with.
+type vec struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	values map[string]*value
+}
+
+type value struct {
+	labelValues []string
+
+	// The value of a counter or gauge, or the sum of a histogram.
+	sum float64
+
+	// The number of observations of a histogram in each bucket, which
+	// are not cumulative.
+	counts []uint64
+	count  uint64
+}
+
+func newVec(name, help, kind string, buckets []float64, labels []string) *vec {
+	v := &vec{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*value),
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry = append(registry, v)
+	return v
+}
+
+// This function must be called with the mutex held.
+func (v *vec) get(labelValues []string) *value {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("%s has %d labels, got %d values", v.name,
+			len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	val, ok := v.values[key]
+	if !ok {
+		val = &value{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(v.buckets)),
+		}
+		v.values[key] = val
+	}
+	return val
+}
+
+func (v *vec) add(labelValues []string, delta float64) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.get(labelValues).sum += delta
+}
+
+// CounterVec is a counter, which only ever goes up, partitioned by the
+// values of its labels.
+type CounterVec struct {
+	vec *vec
+}
+
+// NewCounter creates and registers a counter with the given labels.
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", nil, labels)}
+}
+
+// Inc adds 1 to the counter for the given label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.vec.add(labelValues, 1)
+}
+
+// GaugeVec is a value that can go up and down, partitioned by the
+// values of its labels.
+type GaugeVec struct {
+	vec *vec
+}
+
+// NewGauge creates and registers a gauge with the given labels.
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", nil, labels)}
+}
+
+// Inc adds 1 to the gauge for the given label values.
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.vec.add(labelValues, 1)
+}
+
+// Dec subtracts 1 from the gauge for the given label values.
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.vec.add(labelValues, -1)
+}
+
+// Set replaces the gauge for the given label values.
+func (g *GaugeVec) Set(x float64, labelValues ...string) {
+	g.vec.mutex.Lock()
+	defer g.vec.mutex.Unlock()
+
+	g.vec.get(labelValues).sum = x
+}
+
+// HistogramVec counts observations, such as how long something took,
+// in buckets, partitioned by the values of its labels.
+type HistogramVec struct {
+	vec *vec
+}
+
+// DurationBuckets are buckets in seconds for timing work that should
+// take well under a second.
+var DurationBuckets = []float64{
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05,
+	0.1, 0.25, 0.5, 1,
+}
+
+// NewHistogram creates and registers a histogram with the given upper
+// bounds of its buckets, in increasing order, and labels.
+func NewHistogram(
+	name, help string,
+	buckets []float64,
+	labels ...string,
+) *HistogramVec {
+	return &HistogramVec{newVec(name, help, "histogram", buckets, labels)}
+}
+
+// Observe records an observation for the given label values.
+func (h *HistogramVec) Observe(x float64, labelValues ...string) {
+	h.vec.mutex.Lock()
+	defer h.vec.mutex.Unlock()
+
+	val := h.vec.get(labelValues)
+	val.sum += x
+	val.count++
+	for i, bound := range h.vec.buckets {
+		if x <= bound {
+			val.counts[i]++
+			break
+		}
+	}
+}
+
+// ObserveSince records the time passed since start, in seconds.
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// WriteText writes every registered metric in the Prometheus text
+// format.
+func WriteText(w io.Writer) error {
+	registryMutex.Lock()
+	vecs := append([]*vec(nil), registry...)
+	registryMutex.Unlock()
+
+	for _, v := range vecs {
+		if err := v.writeText(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *vec) writeText(w io.Writer) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n", v.name, escape(v.help, false))
+	fmt.Fprintf(&b, "# TYPE %s %s\n", v.name, v.kind)
+
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		val := v.values[key]
+		if v.kind != "histogram" {
+			fmt.Fprintf(&b, "%s%s %s\n", v.name,
+				v.formatLabels(val.labelValues, ""), formatFloat(val.sum))
+			continue
+		}
+
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += val.counts[i]
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", v.name,
+				v.formatLabels(val.labelValues, formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", v.name,
+			v.formatLabels(val.labelValues, "+Inf"), val.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", v.name,
+			v.formatLabels(val.labelValues, ""), formatFloat(val.sum))
+		fmt.Fprintf(&b, "%s_count%s %d\n", v.name,
+			v.formatLabels(val.labelValues, ""), val.count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatLabels formats the labels of a value, along with the le label
+// of a histogram bucket unless it is empty.
+func (v *vec) formatLabels(labelValues []string, le string) string {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, label := range v.labels {
+		pairs = append(pairs,
+			fmt.Sprintf("%s=\"%s\"", label, escape(labelValues[i], true)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=\"%s\"", le))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(x float64) string {
+	switch {
+	case math.IsInf(x, 1):
+		return "+Inf"
+	case math.IsInf(x, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+func escape(s string, quoted bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quoted {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
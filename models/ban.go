@@ -0,0 +1,29 @@
+package models
+
+import (
+	"crypto/subtle"
+	"time"
+)
+
+// RoomBan keeps a player out of a room for as long as the room lasts.
+// A client is turned away if it presents the banned session token, or
+// comes from the banned IP address. IP is only set when the owner asked
+// for it, since it usually keeps out a whole household.
+type RoomBan struct {
+	ID           string    `json:"id"`
+	PlayerName   string    `json:"playerName"`
+	Reason       string    `json:"reason,omitempty"`
+	IP           string    `json:"ip,omitempty"`
+	SessionToken string    `json:"sessionToken,omitempty"`
+	BannedAt     time.Time `json:"bannedAt"`
+}
+
+// Matches returns whether a client from the given IP address, with the
+// given session token, is banned.
+func (b *RoomBan) Matches(ip string, sessionToken string) bool {
+	if b.IP != "" && b.IP == ip {
+		return true
+	}
+	return b.SessionToken != "" && subtle.ConstantTimeCompare(
+		[]byte(b.SessionToken), []byte(sessionToken)) == 1
+}
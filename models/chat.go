@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Chat channels a message can be posted in.
+const (
+	ChatChannelRoom = "room"
+	ChatChannelTeam = "team"
+)
+
+// MaxChatHistory is the number of chat messages each room keeps around
+// for players who join or rejoin it.
+const MaxChatHistory = 100
+
+// ChatMessage holds a chat message posted in a room. Team and Readers
+// are only meaningful for messages in the team channel. Readers holds
+// the names of the players on the team when it was posted, so that
+// players who switch teams afterwards do not get to read it.
+type ChatMessage struct {
+	Channel    string    `json:"channel"`
+	Team       int       `json:"team"`
+	Readers    []string  `json:"readers,omitempty"`
+	PlayerName string    `json:"playerName"`
+	Text       string    `json:"text"`
+	SentAt     time.Time `json:"sentAt"`
+}
+
+// AddChatMessage adds a message to the room's chat history, dropping
+// the oldest message once the history is full.
+//
+// This function must be called from the room's goroutine.
+func (r *GameRoom) AddChatMessage(msg *ChatMessage) {
+	if len(r.ChatHistory) >= MaxChatHistory {
+		r.ChatHistory[0] = nil
+		r.ChatHistory = r.ChatHistory[1:]
+	}
+	r.ChatHistory = append(r.ChatHistory, msg)
+}
+
+// CanSeeChatMessage returns whether the player is allowed to read a
+// message, i.e. it was posted to the whole room, or to the team they
+// were on at the time.
+//
+// This function must be called from the room's goroutine.
+func (r *GameRoom) CanSeeChatMessage(player *Player, msg *ChatMessage) bool {
+	if msg.Channel == ChatChannelRoom {
+		return true
+	}
+	if player.IsSpectator {
+		return false
+	}
+
+	for _, name := range msg.Readers {
+		if name == player.Name {
+			return true
+		}
+	}
+	return false
+}
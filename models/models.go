@@ -2,21 +2,76 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/logging"
 )
 
 
 // Player holds all the data about a player.
+//
+// Once a player has joined a room, its fields are owned by that room's
+// goroutine.
 type Player struct {
 	Client      interface{}
 	Name        string
 	Room        *GameRoom
 	IsRoomOwner bool
+
+	// Spectators watch a room without having a seat in its game.
+	IsSpectator bool
+
+	// Secret handed to the player's client when they enter a room,
+	// which it must present to take the player's seat again.
+	SessionToken string
+
+	// When the player's current connection was made, or zero if they
+	// are disconnected.
+	ConnectedAt time.Time
+
+	// When the player's last connection went away.
+	DisconnectedAt time.Time
+
+	// When the player last connected, disconnected or sent an action.
+	LastSeen time.Time
+
+	// ID and action of the request the room is currently handling for
+	// the player. The ID is echoed in the messages sent to them
+	// meanwhile, and both are added to the lines logged about them.
+	RequestID string
+	Action    string
+
+	// Numbers and keeps the messages sent to the player.
+	Replay ReplayBuffer
+}
+
+// Logger returns a logger for lines about the player, with their room
+// and the request the room is handling for them.
+//
+// This function must be called from the room's goroutine.
+func (p *Player) Logger() *logging.Logger {
+	logger := logging.With()
+	if p.Room != nil {
+		logger = p.Room.Logger()
+	}
+
+	return logger.With("player", p.Name, "action", p.Action,
+		"requestId", p.RequestID)
+}
+
+// IsConnected returns whether the player currently has a connection.
+func (p *Player) IsConnected() bool {
+	return !p.ConnectedAt.IsZero()
 }
 
 // Game holds the game-specific data and logic.
+//
+// All methods are called from the goroutine of the room that owns
+// the game, so implementations do not need any locking.
 type Game interface {
 	HandleIncomingMessage(
 		player *Player,
@@ -32,30 +87,359 @@ type Game interface {
 	)
 	Kick(playerName string)
 	Rematch(player *Player)
+
+	// UpdatePlayers sends the players and spectators of the room to
+	// everyone after the hub has changed them, e.g. who owns the room or
+	// who is watching. Spectators must only ever be sent the state that
+	// every player can see.
+	UpdatePlayers()
+
+	// PlayerTeam returns the index of the team the player is on, or -1
+	// if they are not on a team. It decides who can read the team chat.
+	PlayerTeam(player *Player) int
+
+	// CheckChat returns an error if the player is not allowed to post in
+	// the given chat channel right now.
+	CheckChat(player *Player, channel string) error
+
+	// State returns the current state of the game, e.g. "waiting-room".
+	State() string
+
+	// PlayerLimits returns the fewest and the most players the game can
+	// be played with. The most is 0 if there is no limit.
+	PlayerLimits() (min int, max int)
+
+	// Stop stops anything the game runs in the background, such as turn
+	// timers, when the game is about to be thrown away. It is called
+	// after any final snapshot has been taken.
+	Stop()
+
+	// Snapshot serializes the full state of the game.
+	Snapshot() (json.RawMessage, error)
+
+	// Restore replaces the state of a newly created game with a
+	// snapshot. The room's players have already been restored when it
+	// is called.
+	Restore(snapshot json.RawMessage) error
 }
 
 type ErrorMessageRequestFn func(*ErrorMessageRequest)
 type OutgoingMessageRequestFn func(*OutgoingMessageRequest)
 
 // GameRoom holds the data about a game room.
+//
+// Each room runs its own goroutine which executes the actions queued
+// with Do one at a time, so the game state and the list of players
+// never need to be locked.
 type GameRoom struct {
-	RoomCode            string
-	GameType            string
-	LastInteractionTime time.Time
-	Game                Game
-	Players             []*Player
+	RoomCode string
+	GameType string
+	Game     Game
+	Players  []*Player
+
+	// Spectators are kept apart from Players so that games never
+	// see them, and are not persisted in snapshots.
+	Spectators []*Player
+
+	// ChatHistory holds the most recent chat messages of the room,
+	// oldest first.
+	ChatHistory []*ChatMessage
+
+	// Password is needed to join the room, unless it is nil.
+	Password *RoomPassword
+
+	// Public rooms are listed in the lobby under their Title.
+	Public bool
+	Title  string
+
+	// MaxPlayers is the most players the owner lets in, or 0 to let in
+	// as many as the game can be played with.
+	MaxPlayers int
+
+	// Waitlist holds the players who are queued for a seat while the
+	// room is full or its game is in progress, first come first.
+	Waitlist []*WaitingPlayer
+
+	// Bans holds the players who may not join the room again.
+	Bans []*RoomBan
+
+	// CreatorIP is the IP address of the client that created the room,
+	// which counts towards the rooms it may have at once.
+	CreatorIP string
+
+	// Fault is set when an action panicked, which leaves the game in an
+	// unknown state. It stays set until the room is reset.
+	Fault *RoomFault
+
+	// OnFault is called from the room's goroutine after an action
+	// panicked and Fault has been set.
+	OnFault func()
+
+	// AfterAction is called from the room's goroutine after each action,
+	// to pick up any changes it made to the room.
+	AfterAction func()
+
+	mutex               sync.Mutex
+	lastInteractionTime time.Time
+	actions             []func()
+	wake                chan struct{}
+	done                chan struct{}
+	closed              bool
+}
+
+// WaitingPlayer is a player on the waitlist of a room, with the request
+// it will be seated with.
+type WaitingPlayer struct {
+	Player  *Player
+	Request api.JoinGameRequest
+}
+
+// RoomFault describes the panic that left a room faulted.
+type RoomFault struct {
+	Error     string
+	Stack     string
+	FaultedAt time.Time
+}
+
+// NewGameRoom creates a new GameRoom. Run must be called to start
+// processing its actions.
+func NewGameRoom(roomCode string, gameType string) *GameRoom {
+	return &GameRoom{
+		RoomCode:            roomCode,
+		GameType:            gameType,
+		Players:             make([]*Player, 0),
+		lastInteractionTime: time.Now(),
+		wake:                make(chan struct{}, 1),
+		done:                make(chan struct{}),
+	}
+}
+
+// Run executes queued actions until the room is closed.
+func (r *GameRoom) Run() {
+	for {
+		select {
+		case <-r.wake:
+		case <-r.done:
+			return
+		}
+
+		for {
+			r.mutex.Lock()
+			if r.closed || len(r.actions) == 0 {
+				r.mutex.Unlock()
+				break
+			}
+			action := r.actions[0]
+			r.actions[0] = nil
+			r.actions = r.actions[1:]
+			r.mutex.Unlock()
+
+			r.runAction(action)
+			if r.AfterAction != nil {
+				r.runAction(r.AfterAction)
+			}
+		}
+	}
+}
+
+// runAction executes an action, and faults the room instead of
+// crashing the server if it panics.
+func (r *GameRoom) runAction(action func()) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+
+		stack := debug.Stack()
+		r.Logger().Error("Room panicked", "error", fmt.Sprint(recovered),
+			"stack", string(stack))
+
+		r.Fault = &RoomFault{
+			Error:     fmt.Sprint(recovered),
+			Stack:     string(stack),
+			FaultedAt: time.Now(),
+		}
+		if r.OnFault != nil {
+			r.notifyFault()
+		}
+	}()
+
+	action()
+}
+
+// notifyFault calls OnFault, only logging it if that panics too.
+func (r *GameRoom) notifyFault() {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			r.Logger().Error("Room panicked while handling a fault",
+				"error", fmt.Sprint(recovered))
+		}
+	}()
+
+	r.OnFault()
+}
+
+// Do queues an action to be executed on the room's goroutine. It never
+// blocks, and returns false if the room has already been closed.
+func (r *GameRoom) Do(action func()) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return false
+	}
+
+	r.actions = append(r.actions, action)
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Close stops the room's goroutine and drops any queued actions.
+func (r *GameRoom) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	r.closed = true
+	r.actions = nil
+	close(r.done)
+}
+
+// Logger returns a logger for lines about the room.
+func (r *GameRoom) Logger() *logging.Logger {
+	return logging.With("room", r.RoomCode, "gameType", r.GameType)
+}
+
+// Touch records that the room has just been interacted with.
+func (r *GameRoom) Touch() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lastInteractionTime = time.Now()
+}
+
+// SetLastInteractionTime overrides the last time the room was
+// interacted with, e.g. when restoring it from a snapshot.
+func (r *GameRoom) SetLastInteractionTime(t time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lastInteractionTime = t
+}
+
+// LastInteractionTime returns the last time the room was interacted with.
+func (r *GameRoom) LastInteractionTime() time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.lastInteractionTime
+}
+
+// FindPlayer returns the player in the room with the given name.
+//
+// This function must be called from the room's goroutine.
+func (r *GameRoom) FindPlayer(name string) *Player {
+	for _, player := range r.Players {
+		if player.Name == name {
+			return player
+		}
+	}
+
+	return nil
+}
+
+// SpectatorNames returns the names of the spectators in the room.
+//
+// This function must be called from the room's goroutine.
+func (r *GameRoom) SpectatorNames() []string {
+	names := make([]string, 0, len(r.Spectators))
+	for _, spectator := range r.Spectators {
+		names = append(names, spectator.Name)
+	}
+	return names
 }
 
 // ErrorMessageRequest is used by game-specific handlers to
 // construct an error message to 1 client.
 type ErrorMessageRequest struct {
-	Player   *Player
-	Fatal bool
-	Error string
+	Player *Player
+	Fatal  bool
+	Error  string
+	Code   api.ErrorCodeT
+	Body   interface{}
+}
+
+// Error is an error with a protocol error code, so that it can be
+// passed on to the client.
+type Error struct {
+	Code    api.ErrorCodeT
+	Message string
+}
+
+// NewError creates an Error.
+func NewError(code api.ErrorCodeT, message string) error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// DecodeRequest decodes the body of a request into req, and checks it
+// against the constraints declared on the fields of req.
+func DecodeRequest(body json.RawMessage, req interface{}) error {
+	if err := json.Unmarshal(body, req); err != nil {
+		return err
+	}
+
+	return api.Validate(req)
+}
+
+// NewRequestError creates the error sent to a player when the body of
+// their request could not be decoded by DecodeRequest. If the request
+// was invalid, the error lists which fields were wrong.
+func NewRequestError(player *Player, err error) *ErrorMessageRequest {
+	if validationErr, ok := err.(*api.ValidationError); ok {
+		return &ErrorMessageRequest{
+			Player: player,
+			Error:  validationErr.Error(),
+			Code:   api.ErrorInvalidRequest,
+			Body:   validationErr,
+		}
+	}
+
+	return &ErrorMessageRequest{
+		Player: player,
+		Error:  "That request could not be read.",
+		Code:   api.ErrorBadRequest,
+	}
+}
+
+// ErrorCodeOf returns the protocol error code of err, or
+// api.ErrorUnknown if it does not have one.
+func ErrorCodeOf(err error) api.ErrorCodeT {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return api.ErrorUnknown
 }
 
 // OutgoingMessageRequest is used by game-specific handlers to
 // construct outgoing messages to clients.
+//
+// PrimaryMsg is sent to PrimaryClient, and SecondaryMsg is sent to
+// every other player and spectator in Room. SecondaryMsg must therefore
+// never contain anything that only some players may see.
 type OutgoingMessageRequest struct {
 	PrimaryClient interface{}
 	PrimaryMsg    *api.OutgoingMessage
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/sndurkin/game-night-in/util"
+)
+
+// RoomPassword holds the salted hash of the password that players need
+// to join a room, so that it is never kept or persisted in the clear.
+type RoomPassword struct {
+	Salt string `json:"salt"`
+	Hash string `json:"hash"`
+}
+
+// NewRoomPassword returns the hash of a password, or nil if it is empty
+// and the room is open to anyone with its code.
+func NewRoomPassword(password string) *RoomPassword {
+	if password == "" {
+		return nil
+	}
+
+	salt := util.GenerateToken()
+	return &RoomPassword{
+		Salt: salt,
+		Hash: hashPassword(salt, password),
+	}
+}
+
+// Matches returns whether the password is the one that was hashed.
+func (p *RoomPassword) Matches(password string) bool {
+	return subtle.ConstantTimeCompare(
+		[]byte(p.Hash), []byte(hashPassword(p.Salt, password))) == 1
+}
+
+func hashPassword(salt, password string) string {
+	sum := sha256.Sum256([]byte(salt + password))
+	return hex.EncodeToString(sum[:])
+}
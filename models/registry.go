@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sndurkin/game-night-in/config"
+)
+
+// GameFactory creates the game for a newly created room.
+type GameFactory func(
+	room *GameRoom,
+	sendOutgoingMessages OutgoingMessageRequestFn,
+	sendErrorMessage ErrorMessageRequestFn,
+) Game
+
+// GameDefinition holds everything the hub needs to know about a
+// game type.
+type GameDefinition struct {
+	// GameType is the protocol name of the game, e.g. "fishbowl".
+	GameType string `json:"gameType"`
+
+	// Display metadata for clients.
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+	MinPlayers  int    `json:"minPlayers"`
+	MaxPlayers  int    `json:"maxPlayers,omitempty"`
+
+	// DefaultSettings returns the settings a new room starts with, in
+	// the game's API format.
+	DefaultSettings func() interface{} `json:"-"`
+
+	// Actions holds the protocol strings of the game-specific actions.
+	Actions []string `json:"actions"`
+
+	// Features lists the optional features of the game, so that clients
+	// can check for them before offering them to players.
+	Features []string `json:"features,omitempty"`
+
+	// Init is called once on program startup, before any game is
+	// created, with the settings of the server.
+	Init func(cfg *config.Config) `json:"-"`
+
+	// NewGame creates the game for a new room.
+	NewGame GameFactory `json:"-"`
+}
+
+// HasAction returns whether the game handles the given action.
+func (d *GameDefinition) HasAction(action string) bool {
+	for _, a := range d.Actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	gameRegistryMutex sync.RWMutex
+	gameRegistry      = make(map[string]*GameDefinition)
+)
+
+// RegisterGame makes a game type available to be created. It is meant
+// to be called from the init function of the game's package, and
+// panics if the game type is already registered.
+func RegisterGame(def *GameDefinition) {
+	gameRegistryMutex.Lock()
+	defer gameRegistryMutex.Unlock()
+
+	if def.GameType == "" || def.NewGame == nil {
+		panic("models: game definition needs a game type and a factory")
+	}
+	if _, ok := gameRegistry[def.GameType]; ok {
+		panic(fmt.Sprintf("models: game type %s registered twice", def.GameType))
+	}
+
+	sort.Strings(def.Actions)
+	gameRegistry[def.GameType] = def
+}
+
+// LookupGame returns the definition of a registered game type.
+func LookupGame(gameType string) (*GameDefinition, bool) {
+	gameRegistryMutex.RLock()
+	defer gameRegistryMutex.RUnlock()
+
+	def, ok := gameRegistry[gameType]
+	return def, ok
+}
+
+// RegisteredGames returns the definitions of all registered game
+// types, sorted by game type.
+func RegisteredGames() []*GameDefinition {
+	gameRegistryMutex.RLock()
+	defer gameRegistryMutex.RUnlock()
+
+	defs := make([]*GameDefinition, 0, len(gameRegistry))
+	for _, def := range gameRegistry {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].GameType < defs[j].GameType
+	})
+	return defs
+}
+
+// IsGameAction returns whether any registered game type handles the
+// given action.
+func IsGameAction(action string) bool {
+	gameRegistryMutex.RLock()
+	defer gameRegistryMutex.RUnlock()
+
+	for _, def := range gameRegistry {
+		if def.HasAction(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// InitGames calls the Init function of every registered game type.
+func InitGames(cfg *config.Config) {
+	for _, def := range RegisteredGames() {
+		if def.Init != nil {
+			def.Init(cfg)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+// MaxReplayMessages is the number of messages kept for each player to
+// resend after they reconnect.
+const MaxReplayMessages = 64
+
+// ReplayBuffer numbers the messages sent to a player and keeps the most
+// recent ones, so that a player who reconnects can be sent the ones
+// they missed. Its zero value is ready to use.
+//
+// It is owned by the goroutine of the player's room.
+type ReplayBuffer struct {
+	lastSeq uint64
+
+	// The encoded messages up to and including lastSeq, oldest first.
+	messages [][]byte
+}
+
+// NextSeq returns the sequence number of the next message, which must
+// then be passed to Add.
+func (b *ReplayBuffer) NextSeq() uint64 {
+	b.lastSeq++
+	return b.lastSeq
+}
+
+// Add keeps the message numbered by the last call to NextSeq, dropping
+// the oldest message once the buffer is full.
+func (b *ReplayBuffer) Add(message []byte) {
+	if len(b.messages) >= MaxReplayMessages {
+		b.messages[0] = nil
+		b.messages = b.messages[1:]
+	}
+	b.messages = append(b.messages, message)
+}
+
+// Reset forgets every message and carries on numbering after lastSeq,
+// so that anyone resuming from before it needs a full resync.
+func (b *ReplayBuffer) Reset(lastSeq uint64) {
+	b.lastSeq = lastSeq
+	b.messages = nil
+}
+
+// LastSeq returns the sequence number of the last message.
+func (b *ReplayBuffer) LastSeq() uint64 {
+	return b.lastSeq
+}
+
+// Since returns the messages numbered after seq, or false if some of
+// them are no longer kept.
+func (b *ReplayBuffer) Since(seq uint64) ([][]byte, bool) {
+	if seq > b.lastSeq || b.lastSeq-seq > uint64(len(b.messages)) {
+		return nil, false
+	}
+
+	return b.messages[len(b.messages)-int(b.lastSeq-seq):], true
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+)
+
+// fillReplayBuffer adds n messages to a buffer, each holding its own
+// sequence number.
+func fillReplayBuffer(b *ReplayBuffer, n int) {
+	for i := 0; i < n; i++ {
+		seq := b.NextSeq()
+		b.Add([]byte(strconv.FormatUint(seq, 10)))
+	}
+}
+
+func TestReplayBufferSince(t *testing.T) {
+	tests := []struct {
+		name    string
+		sent    int
+		reset   uint64
+		after   int
+		since   uint64
+		want    []string
+		wantOK  bool
+		wantSeq uint64
+	}{
+		{
+			name:    "nothing missed",
+			sent:    3,
+			since:   3,
+			want:    []string{},
+			wantOK:  true,
+			wantSeq: 3,
+		},
+		{
+			name:    "some missed",
+			sent:    5,
+			since:   2,
+			want:    []string{"3", "4", "5"},
+			wantOK:  true,
+			wantSeq: 5,
+		},
+		{
+			name:    "everything missed",
+			sent:    3,
+			since:   0,
+			want:    []string{"1", "2", "3"},
+			wantOK:  true,
+			wantSeq: 3,
+		},
+		{
+			name:    "ahead of the server",
+			sent:    3,
+			since:   4,
+			wantOK:  false,
+			wantSeq: 3,
+		},
+		{
+			name:    "oldest messages dropped",
+			sent:    MaxReplayMessages + 10,
+			since:   5,
+			wantOK:  false,
+			wantSeq: MaxReplayMessages + 10,
+		},
+		{
+			name:    "oldest kept message",
+			sent:    MaxReplayMessages + 10,
+			since:   MaxReplayMessages + 8,
+			want:    []string{strconv.Itoa(MaxReplayMessages + 9), strconv.Itoa(MaxReplayMessages + 10)},
+			wantOK:  true,
+			wantSeq: MaxReplayMessages + 10,
+		},
+		{
+			name:    "from before a reset",
+			sent:    3,
+			reset:   3,
+			after:   2,
+			since:   2,
+			wantOK:  false,
+			wantSeq: 5,
+		},
+		{
+			name:    "from after a reset",
+			sent:    3,
+			reset:   3,
+			after:   2,
+			since:   3,
+			want:    []string{"4", "5"},
+			wantOK:  true,
+			wantSeq: 5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b ReplayBuffer
+			fillReplayBuffer(&b, test.sent)
+			if test.reset != 0 {
+				b.Reset(test.reset)
+			}
+			fillReplayBuffer(&b, test.after)
+
+			if seq := b.LastSeq(); seq != test.wantSeq {
+				t.Errorf("LastSeq() = %d, want %d", seq, test.wantSeq)
+			}
+
+			messages, ok := b.Since(test.since)
+			if ok != test.wantOK {
+				t.Fatalf("Since(%d) ok = %v, want %v", test.since, ok,
+					test.wantOK)
+			}
+			if !ok {
+				return
+			}
+
+			if len(messages) != len(test.want) {
+				t.Fatalf("Since(%d) returned %d messages, want %d",
+					test.since, len(messages), len(test.want))
+			}
+			for i, message := range messages {
+				if string(message) != test.want[i] {
+					t.Errorf("Since(%d)[%d] = %s, want %s", test.since, i,
+						message, test.want[i])
+				}
+			}
+		})
+	}
+}
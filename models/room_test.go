@@ -0,0 +1,162 @@
+package models
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runTestRoom starts a room that is closed when the test ends.
+func runTestRoom(t *testing.T) *GameRoom {
+	room := NewGameRoom("1234", "test")
+	go room.Run()
+	t.Cleanup(room.Close)
+	return room
+}
+
+// inTestRoom runs fn on the room's goroutine once the actions queued
+// before it are done, and waits for it.
+func inTestRoom(t *testing.T, room *GameRoom, fn func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	if !room.Do(func() {
+		defer close(done)
+		fn()
+	}) {
+		t.Fatal("Do() = false, want true")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The room did not run the action")
+	}
+}
+
+func TestRoomRunsActionsInOrder(t *testing.T) {
+	const senders, actions = 10, 100
+
+	room := runTestRoom(t)
+	// Only the room's goroutine touches these, so the race detector
+	// complains if actions ever run at the same time.
+	got := make([][]int, senders)
+	afterActions := 0
+	room.AfterAction = func() {
+		afterActions++
+	}
+
+	var wg sync.WaitGroup
+	for sender := 0; sender < senders; sender++ {
+		sender := sender
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < actions; i++ {
+				i := i
+				room.Do(func() {
+					got[sender] = append(got[sender], i)
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	var gotAfterActions int
+	inTestRoom(t, room, func() {
+		gotAfterActions = afterActions
+	})
+
+	want := make([]int, actions)
+	for i := range want {
+		want[i] = i
+	}
+	for sender := range got {
+		if !reflect.DeepEqual(got[sender], want) {
+			t.Errorf("sender %d actions ran in order %v", sender, got[sender])
+		}
+	}
+	if gotAfterActions != senders*actions {
+		t.Errorf("AfterAction ran %d times, want %d", gotAfterActions,
+			senders*actions)
+	}
+}
+
+func TestRoomFaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		onFault   func()
+		wantFault string
+	}{
+		{
+			name:      "without a handler",
+			wantFault: "boom",
+		},
+		{
+			name:      "with a handler",
+			onFault:   func() {},
+			wantFault: "boom",
+		},
+		{
+			name:      "with a handler that panics too",
+			onFault:   func() { panic("again") },
+			wantFault: "boom",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := runTestRoom(t)
+			faults := 0
+			if test.onFault != nil {
+				room.OnFault = func() {
+					faults++
+					test.onFault()
+				}
+			}
+
+			room.Do(func() { panic("boom") })
+			ran := false
+			room.Do(func() { ran = true })
+			inTestRoom(t, room, func() {})
+
+			if room.Fault == nil || room.Fault.Error != test.wantFault {
+				t.Errorf("Fault = %+v, want %s", room.Fault, test.wantFault)
+			}
+			if !ran {
+				t.Error("The room stopped running actions after a panic")
+			}
+			if test.onFault != nil && faults != 1 {
+				t.Errorf("OnFault ran %d times, want 1", faults)
+			}
+		})
+	}
+}
+
+func TestRoomClose(t *testing.T) {
+	room := NewGameRoom("1234", "test")
+	ran := false
+	if !room.Do(func() { ran = true }) {
+		t.Fatal("Do() before Close() = false, want true")
+	}
+
+	room.Close()
+	room.Close()
+	if room.Do(func() { ran = true }) {
+		t.Error("Do() after Close() = true, want false")
+	}
+
+	// Run returns straight away, without running what was queued.
+	done := make(chan struct{})
+	go func() {
+		room.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return for a closed room")
+	}
+	if ran {
+		t.Error("The room ran an action queued before it was closed")
+	}
+}
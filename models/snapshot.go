@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RoomSnapshot holds everything needed to bring a room back after the
+// server restarts.
+type RoomSnapshot struct {
+	RoomCode            string           `json:"roomCode"`
+	GameType            string           `json:"gameType"`
+	LastInteractionTime time.Time        `json:"lastInteractionTime"`
+	Players             []PlayerSnapshot `json:"players"`
+	ChatHistory         []*ChatMessage   `json:"chatHistory,omitempty"`
+	Password            *RoomPassword    `json:"password,omitempty"`
+	Public              bool             `json:"public,omitempty"`
+	Title               string           `json:"title,omitempty"`
+	MaxPlayers          int              `json:"maxPlayers,omitempty"`
+	Bans                []*RoomBan       `json:"bans,omitempty"`
+	CreatorIP           string           `json:"creatorIP,omitempty"`
+	Game                json.RawMessage  `json:"game"`
+}
+
+// PlayerSnapshot holds the persisted data about a player. Games refer
+// to players in their own snapshots by name.
+type PlayerSnapshot struct {
+	Name         string `json:"name"`
+	IsRoomOwner  bool   `json:"isRoomOwner,omitempty"`
+	SessionToken string `json:"sessionToken"`
+
+	// The sequence number of the last message sent to the player.
+	LastSeq uint64 `json:"lastSeq,omitempty"`
+}
+
+// RoomStore persists room snapshots.
+type RoomStore interface {
+	Save(snapshot *RoomSnapshot) error
+	Delete(roomCode string) error
+	LoadAll() ([]*RoomSnapshot, error)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sndurkin/game-night-in/config"
+)
+
+var (
+	errOutboxClosed = errors.New("outbox is closed")
+	errSlowClient   = errors.New("client is not reading its messages")
+)
+
+var (
+	// Events that are sent ahead of any other waiting messages, along
+	// with every error. Numbered messages are never reordered, so that
+	// clients can resume from the last one they received.
+	priorityEvents = map[string]bool{
+		"error":                true,
+		"incompatible-version": true,
+		"resumed":              true,
+		"session":              true,
+		"welcome":              true,
+	}
+
+	// Events that hold the whole state of a room, where a newer one
+	// replaces the one still waiting. The number of the one replaced is
+	// skipped, which clients do not mind: they only keep the last number
+	// they received, and resume from the replay buffer after it.
+	stateEvents = map[string]bool{
+		"updated-game": true,
+		"updated-room": true,
+	}
+)
+
+// outbox holds the messages waiting to be written to a client. Unlike
+// a channel, it never blocks the rooms that send to it: state updates
+// that have not been written yet are replaced by newer ones, and the
+// client is only disconnected once it has stopped reading for a while,
+// or in the unlikely case that far too many messages are waiting.
+type outbox struct {
+	mutex    sync.Mutex
+	priority [][]byte
+	messages []queuedMessage
+	closed   bool
+
+	// Payload of the close message that the writer sends once the
+	// waiting messages are written, e.g. the close code.
+	closePayload []byte
+
+	// When the writer last took the waiting messages, or when a message
+	// started waiting if there were none.
+	lastTaken time.Time
+
+	// Signals the writer that there are messages to take, or that the
+	// outbox has been closed.
+	ready chan struct{}
+
+	// How long the client can leave its messages waiting, and how many
+	// of them, before it is disconnected.
+	slowClientTimeout time.Duration
+	maxQueuedMessages int
+}
+
+type queuedMessage struct {
+	event string
+	data  []byte
+}
+
+func newOutbox(cfg config.ConnectionConfig) *outbox {
+	return &outbox{
+		ready:             make(chan struct{}, 1),
+		slowClientTimeout: cfg.SlowClientTimeout.Duration,
+		maxQueuedMessages: cfg.MaxQueuedMessages,
+	}
+}
+
+// push queues a message. If the client has not taken its messages for
+// too long, the outbox is closed instead and errSlowClient is returned.
+func (o *outbox) push(data []byte) error {
+	var header struct {
+		Event string `json:"event"`
+		Error string `json:"error"`
+		Seq   uint64 `json:"seq"`
+	}
+	json.Unmarshal(data, &header)
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.closed {
+		return errOutboxClosed
+	}
+
+	numWaiting := len(o.priority) + len(o.messages)
+	if numWaiting == 0 {
+		o.lastTaken = time.Now()
+	} else if numWaiting >= o.maxQueuedMessages ||
+		time.Since(o.lastTaken) > o.slowClientTimeout {
+		o.closeLocked()
+		return errSlowClient
+	}
+
+	switch {
+	case header.Seq == 0 && (header.Error != "" || priorityEvents[header.Event]):
+		o.priority = append(o.priority, data)
+	case stateEvents[header.Event]:
+		o.pushState(queuedMessage{header.Event, data})
+	default:
+		o.messages = append(o.messages, queuedMessage{header.Event, data})
+	}
+
+	o.signal()
+	return nil
+}
+
+// pushState queues a state update, dropping the waiting update for
+// the same event if there is one. The client replaces its state with
+// each update, so it would never see the older one anyway. The new
+// update goes at the end of the queue, so that the numbers of the
+// messages still go up.
+//
+// This function must be called with the mutex held.
+func (o *outbox) pushState(msg queuedMessage) {
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].event == msg.event {
+			o.messages = append(o.messages[:i], o.messages[i+1:]...)
+			break
+		}
+	}
+
+	o.messages = append(o.messages, msg)
+}
+
+// take returns every waiting message, priority messages first, and
+// whether the outbox has been closed.
+func (o *outbox) take() ([][]byte, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	messages := o.priority
+	for _, msg := range o.messages {
+		messages = append(messages, msg.data)
+	}
+	o.priority = nil
+	o.messages = nil
+	o.lastTaken = time.Now()
+
+	return messages, o.closed
+}
+
+// close stops the outbox from taking any more messages. The writer
+// still takes the ones that are waiting. It is safe to call more than
+// once.
+func (o *outbox) close() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.closeLocked()
+}
+
+// closeWith closes the outbox like close, and sets the payload of the
+// close message the writer sends, unless it was already closed.
+func (o *outbox) closeWith(payload []byte) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if !o.closed {
+		o.closePayload = payload
+	}
+	o.closeLocked()
+}
+
+// finalPayload returns the payload of the close message to send once
+// the outbox has been closed.
+func (o *outbox) finalPayload() []byte {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.closePayload
+}
+
+// This function must be called with the mutex held.
+func (o *outbox) closeLocked() {
+	if !o.closed {
+		o.closed = true
+		o.signal()
+	}
+}
+
+func (o *outbox) isClosed() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.closed
+}
+
+// This function must be called with the mutex held.
+func (o *outbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sndurkin/game-night-in/config"
+)
+
+func testOutbox(maxQueued int) *outbox {
+	return newOutbox(config.ConnectionConfig{
+		SlowClientTimeout: config.Duration{Duration: time.Minute},
+		MaxQueuedMessages: maxQueued,
+	})
+}
+
+func TestOutboxOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		pushed []string
+		want   []string
+	}{
+		{
+			name: "messages keep their order",
+			pushed: []string{
+				`{"event":"chat","seq":1}`,
+				`{"event":"chat","seq":2}`,
+			},
+			want: []string{
+				`{"event":"chat","seq":1}`,
+				`{"event":"chat","seq":2}`,
+			},
+		},
+		{
+			name: "priority events jump the queue",
+			pushed: []string{
+				`{"event":"chat"}`,
+				`{"event":"session"}`,
+				`{"event":"welcome"}`,
+			},
+			want: []string{
+				`{"event":"session"}`,
+				`{"event":"welcome"}`,
+				`{"event":"chat"}`,
+			},
+		},
+		{
+			name: "errors jump the queue",
+			pushed: []string{
+				`{"event":"chat"}`,
+				`{"error":"Something went wrong."}`,
+			},
+			want: []string{
+				`{"error":"Something went wrong."}`,
+				`{"event":"chat"}`,
+			},
+		},
+		{
+			name: "numbered priority events keep their place",
+			pushed: []string{
+				`{"event":"chat","seq":1}`,
+				`{"event":"error","seq":2}`,
+			},
+			want: []string{
+				`{"event":"chat","seq":1}`,
+				`{"event":"error","seq":2}`,
+			},
+		},
+		{
+			name: "state updates replace the one waiting before them",
+			pushed: []string{
+				`{"event":"updated-room","n":1}`,
+				`{"event":"updated-room","n":2}`,
+			},
+			want: []string{
+				`{"event":"updated-room","n":2}`,
+			},
+		},
+		{
+			name: "state updates only replace the same event",
+			pushed: []string{
+				`{"event":"updated-room","n":1}`,
+				`{"event":"updated-game","n":2}`,
+			},
+			want: []string{
+				`{"event":"updated-room","n":1}`,
+				`{"event":"updated-game","n":2}`,
+			},
+		},
+		{
+			name: "state updates replace the one waiting further back",
+			pushed: []string{
+				`{"event":"updated-room","n":1}`,
+				`{"event":"chat"}`,
+				`{"event":"updated-room","n":2}`,
+			},
+			want: []string{
+				`{"event":"chat"}`,
+				`{"event":"updated-room","n":2}`,
+			},
+		},
+		{
+			name: "numbered state updates replace each other",
+			pushed: []string{
+				`{"event":"updated-game","seq":1}`,
+				`{"event":"updated-room","seq":2}`,
+				`{"event":"chat","seq":3}`,
+				`{"event":"updated-game","seq":4}`,
+				`{"event":"updated-game","seq":5}`,
+			},
+			want: []string{
+				`{"event":"updated-room","seq":2}`,
+				`{"event":"chat","seq":3}`,
+				`{"event":"updated-game","seq":5}`,
+			},
+		},
+		{
+			name: "numbered and unnumbered state updates replace each other",
+			pushed: []string{
+				`{"event":"updated-game"}`,
+				`{"event":"updated-game","seq":1}`,
+			},
+			want: []string{
+				`{"event":"updated-game","seq":1}`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := testOutbox(16)
+			for _, msg := range test.pushed {
+				if err := o.push([]byte(msg)); err != nil {
+					t.Fatalf("push(%s) = %v", msg, err)
+				}
+			}
+
+			messages, closed := o.take()
+			if closed {
+				t.Errorf("take() closed = true, want false")
+			}
+			if len(messages) != len(test.want) {
+				t.Fatalf("take() returned %d messages, want %d",
+					len(messages), len(test.want))
+			}
+			for i, msg := range messages {
+				if string(msg) != test.want[i] {
+					t.Errorf("take()[%d] = %s, want %s", i, msg, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOutboxSlowClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxQueued int
+		pushed    int
+		idle      time.Duration
+		wantErr   error
+	}{
+		{
+			name:      "under the limit",
+			maxQueued: 4,
+			pushed:    4,
+		},
+		{
+			name:      "too many waiting",
+			maxQueued: 4,
+			pushed:    5,
+			wantErr:   errSlowClient,
+		},
+		{
+			name:      "waiting too long",
+			maxQueued: 4,
+			pushed:    2,
+			idle:      2 * time.Minute,
+			wantErr:   errSlowClient,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := testOutbox(test.maxQueued)
+
+			var err error
+			for i := 0; i < test.pushed && err == nil; i++ {
+				err = o.push([]byte(`{"event":"chat"}`))
+				o.lastTaken = o.lastTaken.Add(-test.idle)
+			}
+			if err != test.wantErr {
+				t.Fatalf("push() = %v, want %v", err, test.wantErr)
+			}
+			if closed := o.isClosed(); closed != (test.wantErr != nil) {
+				t.Errorf("isClosed() = %v, want %v", closed, !closed)
+			}
+			if test.wantErr != nil {
+				if err := o.push([]byte(`{"event":"chat"}`)); err != errOutboxClosed {
+					t.Errorf("push() after closing = %v, want %v", err,
+						errOutboxClosed)
+				}
+			}
+		})
+	}
+}
@@ -26,6 +26,8 @@ class App extends Component {
     this.state = {
       state: null,
       conn: null,
+      // What the server and each game support, from its welcome.
+      server: null,
 
       screen: Constants.Screens.HOME,
       game: {},
@@ -49,6 +51,32 @@ class App extends Component {
         });
       },
       onMessage: (data, e) => {
+        if (data.event === Constants.Events.SESSION) {
+          // Keep the secret needed to reconnect as the same player.
+          window.top.SessionStorage[Constants.LocalStorage.SESSION_TOKEN] = data.body.sessionToken;
+          localStorage.setItem(Constants.LocalStorage.SESSION_TOKEN, data.body.sessionToken);
+          return;
+        }
+        if (data.event === Constants.Events.WELCOME) {
+          this.setState({ server: data.body });
+          return;
+        }
+        if (data.event === Constants.Events.NOTICE) {
+          window.alert(data.body.message);
+          return;
+        }
+        if (data.event === Constants.Events.UPDATED_BANS) {
+          this.updateStoreData({ bans: data.body.bans });
+          return;
+        }
+        if (data.errorIsFatal && (data.errorCode === Constants.ErrorCodes.KICKED
+            || data.errorCode === Constants.ErrorCodes.BANNED)) {
+          // The screen reloads on fatal errors, so say why first. The
+          // session is gone, so there is nothing to rejoin with.
+          localStorage.removeItem(Constants.LocalStorage.SESSION_TOKEN);
+          window.alert(data.error);
+        }
+
         this.getActiveScreen().handleMessage(data, e);
       },
       onDisconnect: () => {
@@ -65,6 +93,7 @@ class App extends Component {
     if (this.state.screen === Constants.Screens.HOME) {
       delete window.top.SessionStorage[Constants.LocalStorage.PLAYER_NAME];
       delete window.top.SessionStorage[Constants.LocalStorage.ROOM_CODE];
+      delete window.top.SessionStorage[Constants.LocalStorage.SESSION_TOKEN];
     }
   }
 
@@ -14,16 +14,29 @@ export default class Connection {
 
     console.log('connect(' + reconnectAttemptNumber + ')');
     return new Promise((resolve, reject) => {
-      let params = '';
+      let params = '?protocolVersion=' + Constants.PROTOCOL_VERSION;
       if (window.top.SessionStorage[Constants.LocalStorage.ROOM_CODE]) {
-        params += '?name=' + window.top.SessionStorage[Constants.LocalStorage.PLAYER_NAME]
-          + '&roomCode=' + window.top.SessionStorage[Constants.LocalStorage.ROOM_CODE];
+        params += '&name=' + window.top.SessionStorage[Constants.LocalStorage.PLAYER_NAME]
+          + '&roomCode=' + window.top.SessionStorage[Constants.LocalStorage.ROOM_CODE]
+          + '&sessionToken=' + (window.top.SessionStorage[Constants.LocalStorage.SESSION_TOKEN] || '');
+        if (this.lastSeq) {
+          // Only the messages missed since then are sent again.
+          params += '&lastSeq=' + this.lastSeq;
+        }
       }
       this.conn = new WebSocket(protocol + '://' + document.location.host + '/ws' + params);
       this.onConnecting && this.onConnecting();
 
       this.conn.onopen = () => {
         console.log('WebSocket.onopen');
+        this.reconnectAfter = 0;
+        this.conn.send(JSON.stringify({
+          action: Constants.Actions.HELLO,
+          body: {
+            protocolVersion: Constants.PROTOCOL_VERSION,
+            capabilities: ['batched-messages', 'resume'],
+          },
+        }));
         this.onConnect && this.onConnect();
         resolve();
       };
@@ -33,14 +46,26 @@ export default class Connection {
       };
 
       this.conn.onmessage = (e) => {
-        const data = JSON.parse(e.data);
-        this.onMessage && this.onMessage(data, e);
+        // Several messages can arrive together, one per line.
+        e.data.split('\n').forEach((line) => {
+          const data = JSON.parse(line);
+          if (data.seq) {
+            this.lastSeq = data.seq;
+          }
+          if (data.event === Constants.Events.SERVER_RESTARTING) {
+            // Wait for the server to come back before reconnecting.
+            this.reconnectAfter = data.body.reconnectAfter;
+            return;
+          }
+          this.onMessage && this.onMessage(data, e);
+        });
       };
 
       this.conn.onclose = (e) => {
         console.log('WebSocket.onclose');
         if (reconnectAttemptNumber < 3) {
-          this.connect(reconnectAttemptNumber + 1);
+          const delay = (this.reconnectAfter || 0) * (reconnectAttemptNumber + 1);
+          setTimeout(() => this.connect(reconnectAttemptNumber + 1), delay);
         } else {
           this.onDisconnect && this.onDisconnect();
         }
@@ -1,4 +1,6 @@
 export default {
+  // Newest version of the server protocol that this client speaks.
+  PROTOCOL_VERSION: 2,
   Screens: {
     HOME: 'home',
     CREATE_GAME: 'create-game',
@@ -9,11 +11,27 @@ export default {
     CREATE_GAME: 'create-game',
     JOIN_GAME: 'join-game',
     REMATCH: 'rematch',
+    HELLO: 'hello',
+    SUBSCRIBE_LOBBY: 'subscribe-lobby',
+    UNSUBSCRIBE_LOBBY: 'unsubscribe-lobby',
+    BAN_PLAYER: 'ban-player',
+    UNBAN_PLAYER: 'unban-player',
   },
   Events: {
     CREATED_GAME: 'created-game',
     UPDATED_ROOM: 'updated-room',
     UPDATED_GAME: 'updated-game',
+    SESSION: 'session',
+    WELCOME: 'welcome',
+    NOTICE: 'notice',
+    SERVER_RESTARTING: 'server-restarting',
+    UPDATED_LOBBY: 'updated-lobby',
+    UPDATED_WAITLIST: 'updated-waitlist',
+    UPDATED_BANS: 'updated-bans',
+  },
+  ErrorCodes: {
+    KICKED: 'kicked',
+    BANNED: 'banned',
   },
   TeamColors: [
     '#cc0000',    // Red
@@ -30,5 +48,6 @@ export default {
   LocalStorage: {
     PLAYER_NAME: 'playerName',
     ROOM_CODE: 'roomCode',
+    SESSION_TOKEN: 'sessionToken',
   },
 };
@@ -15,16 +15,22 @@ export default class CreateGameScreen extends Component {
     this.state = {
       gameType: 'fishbowl',
       name: localStorage.getItem(Constants.LocalStorage.PLAYER_NAME) || '',
+      password: '',
+      isPublic: false,
+      title: '',
       error: '',
     };
 
     this.onSelectGameType = this.onSelectGameType.bind(this);
     this.onNameChange = this.onNameChange.bind(this);
+    this.onPasswordChange = this.onPasswordChange.bind(this);
+    this.onPublicChange = this.onPublicChange.bind(this);
+    this.onTitleChange = this.onTitleChange.bind(this);
     this.createGame = this.createGame.bind(this);
   }
 
   render() {
-    const { gameType, name, error } = this.state;
+    const { gameType, name, password, isPublic, title, error } = this.state;
 
     return html`
       <${ScreenWrapper}
@@ -54,6 +60,36 @@ export default class CreateGameScreen extends Component {
                 placeholder="Enter your name"
                 onInput=${this.onNameChange} />
             </label>
+            <label>
+              Password
+              <input
+                name="password"
+                autocomplete="off"
+                type="password"
+                maxlength="64"
+                value=${password}
+                placeholder="Optional, to keep strangers out"
+                onInput=${this.onPasswordChange} />
+            </label>
+            <label>
+              <input
+                type="checkbox"
+                checked=${isPublic}
+                onChange=${this.onPublicChange} />
+              <span class="checkable">List it in the open games</span>
+            </label>
+            ${isPublic && html`
+              <label>
+                Title
+                <input
+                  name="title"
+                  type="text"
+                  maxlength="60"
+                  value=${title}
+                  placeholder="Optional, e.g. Friday game night"
+                  onInput=${this.onTitleChange} />
+              </label>
+            `}
             <button type="submit" class="lone">Create</button>
           </form>
         </div>
@@ -108,11 +144,23 @@ export default class CreateGameScreen extends Component {
     this.setState({ name: e.target.value });
   }
 
+  onPasswordChange(e) {
+    this.setState({ password: e.target.value });
+  }
+
+  onPublicChange(e) {
+    this.setState({ isPublic: e.target.checked });
+  }
+
+  onTitleChange(e) {
+    this.setState({ title: e.target.value });
+  }
+
   createGame(e) {
     e.preventDefault();
 
     const { conn } = this.props;
-    const { gameType, name } = this.state;
+    const { gameType, name, password, isPublic, title } = this.state;
     const trimmedName = name.trim();
     if (trimmedName.length === 0) {
       this.setState({ error: 'Please enter a name first.' });
@@ -127,6 +175,9 @@ export default class CreateGameScreen extends Component {
       body: {
         gameType: gameType,
         name: trimmedName,
+        password: password || undefined,
+        public: isPublic || undefined,
+        title: isPublic && title.trim() || undefined,
       },
     }));
   }
@@ -49,6 +49,8 @@ export default class FishbowlRoomScreen extends Component {
 
       showKickPlayerModal: false,
       playerToKick: null,
+      kickReason: '',
+      banIp: false,
     };
 
     this.onWordChange = this.onWordChange.bind(this);
@@ -69,7 +71,11 @@ export default class FishbowlRoomScreen extends Component {
     this.addTeam = this.addTeam.bind(this);
     this.removeTeam = this.removeTeam.bind(this);
     this.movePlayer = this.movePlayer.bind(this);
+    this.hideKickPlayerModal = this.hideKickPlayerModal.bind(this);
+    this.onKickReasonChange = this.onKickReasonChange.bind(this);
+    this.onBanIpChange = this.onBanIpChange.bind(this);
     this.kickPlayer = this.kickPlayer.bind(this);
+    this.banPlayer = this.banPlayer.bind(this);
     this.startGame = this.startGame.bind(this);
   }
 
@@ -265,7 +271,7 @@ export default class FishbowlRoomScreen extends Component {
     const { name, isRoomOwner } = this.props;
     const {
       showMovePlayerModal, teamIdxToMoveFrom,
-      showKickPlayerModal, playerToKick,
+      showKickPlayerModal, playerToKick, kickReason, banIp,
     } = this.state;
     const teams = this.props.teams || [];
 
@@ -330,6 +336,7 @@ export default class FishbowlRoomScreen extends Component {
             </button>
           ` : null}
         </div>
+        ${this.renderBans()}
       </div>
       ${this.renderButtonBar()}
       <div class="modal">
@@ -369,11 +376,32 @@ export default class FishbowlRoomScreen extends Component {
             <label for="kick-player-modal" class="close">✖</label>
           </header>
           <section class="content">
+            <label>
+              Reason
+              <input
+                type="text"
+                maxlength="200"
+                value=${kickReason}
+                placeholder="Optional, shown to the player"
+                onInput=${this.onKickReasonChange} />
+            </label>
+            <label>
+              <input
+                type="checkbox"
+                checked=${banIp}
+                onChange=${this.onBanIpChange} />
+              <span class="checkable">
+                When banning, also ban everyone on their network
+              </span>
+            </label>
             <div class="button-bar">
               <button class="pseudo" onClick=${this.hideKickPlayerModal}>
                 Cancel
               </button>
               <div />
+              <button class="error" onClick=${this.banPlayer}>
+                Ban
+              </button>
               <button onClick=${this.kickPlayer}>
                 Kick
               </button>
@@ -385,6 +413,30 @@ export default class FishbowlRoomScreen extends Component {
     `;
   }
 
+  renderBans() {
+    const { isRoomOwner, bans } = this.props;
+    if (!isRoomOwner || !bans || bans.length === 0) {
+      return null;
+    }
+
+    return html`
+      <div class="fishbowl-bans">
+        <h4>Banned players</h4>
+        ${bans.map(ban => html`
+          <div class="fishbowl-team-row">
+            <div class="fishbowl-player-name">
+              ${ban.playerName}${ban.bansIp ? ' and their network' : ''}
+              ${ban.reason ? ` (${ban.reason})` : ''}
+            </div>
+            <a role="link" onClick=${() => this.unbanPlayer(ban)}>
+              Unban
+            </a>
+          </div>
+        `)}
+      </div>
+    `;
+  }
+
   renderSettingsSummary() {
     const { isRoomOwner } = this.props;
     const {
@@ -676,6 +728,8 @@ export default class FishbowlRoomScreen extends Component {
     this.setState({
       showKickPlayerModal: true,
       playerToKick: player,
+      kickReason: '',
+      banIp: false,
     });
   }
 
@@ -686,6 +740,14 @@ export default class FishbowlRoomScreen extends Component {
     });
   }
 
+  onKickReasonChange(e) {
+    this.setState({ kickReason: e.target.value });
+  }
+
+  onBanIpChange(e) {
+    this.setState({ banIp: e.target.checked });
+  }
+
   movePlayer({ name, teamIdxToMoveFrom, teamIdxToMoveTo }) {
     const { conn } = this.props;
     conn.send(JSON.stringify({
@@ -710,13 +772,35 @@ export default class FishbowlRoomScreen extends Component {
       action: FishbowlConstants.Actions.KICK_PLAYER,
       body: {
         playerName: this.state.playerToKick.name,
+        reason: this.state.kickReason,
       },
     }));
 
-    this.setState({
-      showKickPlayerModal: false,
-      playerToKick: null,
-    });
+    this.hideKickPlayerModal();
+  }
+
+  banPlayer() {
+    const { conn } = this.props;
+    conn.send(JSON.stringify({
+      action: Constants.Actions.BAN_PLAYER,
+      body: {
+        playerName: this.state.playerToKick.name,
+        reason: this.state.kickReason,
+        banIp: this.state.banIp,
+      },
+    }));
+
+    this.hideKickPlayerModal();
+  }
+
+  unbanPlayer(ban) {
+    const { conn } = this.props;
+    conn.send(JSON.stringify({
+      action: Constants.Actions.UNBAN_PLAYER,
+      body: {
+        banId: ban.id,
+      },
+    }));
   }
 
   startGame() {
@@ -16,16 +16,35 @@ export default class JoinGameScreen extends Component {
     this.state = {
       name: localStorage.getItem(Constants.LocalStorage.PLAYER_NAME) || '',
       roomCode: localStorage.getItem(Constants.LocalStorage.ROOM_CODE) || '',
+      password: '',
+      publicRooms: [],
+      waitlistPosition: 0,
       error: '',
     };
 
     this.onNameChange = this.onNameChange.bind(this);
     this.onRoomCodeChange = this.onRoomCodeChange.bind(this);
+    this.onPasswordChange = this.onPasswordChange.bind(this);
     this.joinGame = this.joinGame.bind(this);
   }
 
+  componentDidMount() {
+    this.sendLobbyAction(Constants.Actions.SUBSCRIBE_LOBBY);
+  }
+
+  componentWillUnmount() {
+    this.sendLobbyAction(Constants.Actions.UNSUBSCRIBE_LOBBY);
+  }
+
+  sendLobbyAction(action) {
+    const { conn } = this.props;
+    if (conn) {
+      conn.send(JSON.stringify({ action: action }));
+    }
+  }
+
   render() {
-    const { name, roomCode, error } = this.state;
+    const { name, roomCode, password, waitlistPosition, error } = this.state;
 
     return html`
       <${ScreenWrapper}
@@ -36,6 +55,12 @@ export default class JoinGameScreen extends Component {
           ${error && html`
             <span class="label error">${error}</span>
           `}
+          ${waitlistPosition > 0 && html`
+            <span class="label">
+              This game is full or in progress. You are number ${waitlistPosition}
+              in line, and will join as soon as a seat opens up.
+            </span>
+          `}
           <form onSubmit=${this.joinGame}>
             <label>
               Room code
@@ -43,7 +68,7 @@ export default class JoinGameScreen extends Component {
                 name="room-code"
                 autocomplete="room-code"
                 type="text"
-                maxlength="4"
+                maxlength="32"
                 value=${roomCode}
                 placeholder="Enter the room invite code"
                 onInput=${this.onRoomCodeChange} />
@@ -59,19 +84,70 @@ export default class JoinGameScreen extends Component {
                 placeholder="Enter your name"
                 onInput=${this.onNameChange} />
             </label>
+            <label>
+              Password
+              <input
+                name="password"
+                autocomplete="off"
+                type="password"
+                maxlength="64"
+                value=${password}
+                placeholder="Only if the room has one"
+                onInput=${this.onPasswordChange} />
+            </label>
             <button type="submit" class="lone">Join</button>
           </form>
+          ${this.renderPublicRooms()}
         </div>
       <//>
     `;
   }
 
+  renderPublicRooms() {
+    const { publicRooms } = this.state;
+    if (publicRooms.length === 0) {
+      return null;
+    }
+
+    return html`
+      <h3>Open games</h3>
+      <ul class="public-rooms">
+        ${publicRooms.map(room => html`
+          <li>
+            <a href="#" onClick=${e => this.selectPublicRoom(e, room)}>
+              ${room.title}
+            </a>
+            <span>
+              ${' '}${room.gameType}, ${room.players}${room.maxPlayers ? '/' + room.maxPlayers : ''} players,
+              ${room.state === 'waiting-room' ? 'waiting to start' : 'in progress'}
+              ${room.hasPassword ? ', needs a password' : ''}
+            </span>
+          </li>
+        `)}
+      </ul>
+    `;
+  }
+
+  selectPublicRoom(e, room) {
+    e.preventDefault();
+    this.setState({ roomCode: room.roomCode });
+  }
+
   handleMessage(data, e) {
     if (data.error) {
       this.setState({ error: data.error });
       return;
     }
 
+    if (data.event === Constants.Events.UPDATED_LOBBY) {
+      this.setState({ publicRooms: data.body.rooms });
+      return;
+    }
+    if (data.event === Constants.Events.UPDATED_WAITLIST) {
+      this.setState({ waitlistPosition: data.body.position, error: '' });
+      return;
+    }
+
     const sharedProps = {
       name: this.state.name,
       isRoomOwner: false,
@@ -151,14 +227,18 @@ export default class JoinGameScreen extends Component {
   }
 
   onRoomCodeChange(e) {
-    this.setState({ roomCode: e.target.value });
+    this.setState({ roomCode: e.target.value.toUpperCase() });
+  }
+
+  onPasswordChange(e) {
+    this.setState({ password: e.target.value });
   }
 
   joinGame(e) {
     e.preventDefault();
 
     const { conn } = this.props;
-    const { roomCode, name } = this.state;
+    const { roomCode, name, password } = this.state;
 
     if (roomCode.length === 0) {
       this.setState({ error: 'Please enter a room code.' });
@@ -171,6 +251,13 @@ export default class JoinGameScreen extends Component {
       return;
     }
 
+    // Only a session token from the same room and name can take back a seat.
+    let sessionToken;
+    if (localStorage.getItem(Constants.LocalStorage.ROOM_CODE) === roomCode
+        && localStorage.getItem(Constants.LocalStorage.PLAYER_NAME) === trimmedName) {
+      sessionToken = localStorage.getItem(Constants.LocalStorage.SESSION_TOKEN);
+    }
+
     localStorage.setItem(Constants.LocalStorage.PLAYER_NAME, trimmedName);
     localStorage.setItem(Constants.LocalStorage.ROOM_CODE, roomCode);
     window.top.SessionStorage[Constants.LocalStorage.PLAYER_NAME] = trimmedName;
@@ -181,6 +268,8 @@ export default class JoinGameScreen extends Component {
       body: {
         roomCode: roomCode,
         name: trimmedName,
+        password: password || undefined,
+        sessionToken: sessionToken || undefined,
       },
     }));
   }
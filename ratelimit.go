@@ -0,0 +1,263 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/config"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// tokenBucket implements a single rate limit. It is not safe for
+// concurrent use.
+type tokenBucket struct {
+	limit  config.RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit config.RateLimit) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: limit.Burst,
+		last:   time.Now(),
+	}
+}
+
+// allow takes a token from the bucket, and returns false if there were
+// none left.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > b.limit.Burst {
+		b.tokens = b.limit.Burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// clientRateLimiter throttles the messages of a single connection. It
+// is only used from the connection's readPump goroutine.
+type clientRateLimiter struct {
+	limits     config.RateLimitConfig
+	connection *tokenBucket
+	actions    map[string]*tokenBucket
+}
+
+func newClientRateLimiter(limits config.RateLimitConfig) *clientRateLimiter {
+	return &clientRateLimiter{
+		limits:     limits,
+		connection: newTokenBucket(limits.Connection),
+		actions:    make(map[string]*tokenBucket),
+	}
+}
+
+// Key of the bucket shared by every action the server does not know,
+// so that made-up actions can neither add buckets without end nor get
+// around the limit of each action.
+const unknownAction = ""
+
+// allow returns whether a message with the given action may be handled
+// now.
+func (l *clientRateLimiter) allow(action string) bool {
+	now := time.Now()
+	if !l.connection.allow(now) {
+		return false
+	}
+
+	if _, ok := api.ActionLookup[action]; !ok && !models.IsGameAction(action) {
+		action = unknownAction
+	}
+
+	bucket, ok := l.actions[action]
+	if !ok {
+		limit, ok := l.limits.Actions[action]
+		if !ok {
+			limit = l.limits.DefaultAction
+		}
+		bucket = newTokenBucket(limit)
+		l.actions[action] = bucket
+	}
+	return bucket.allow(now)
+}
+
+// connectionLimiter counts the open connections of each IP address.
+type connectionLimiter struct {
+	mutex       sync.Mutex
+	connections map[string]int
+	max         int
+}
+
+func newConnectionLimiter(max int) *connectionLimiter {
+	return &connectionLimiter{
+		connections: make(map[string]int),
+		max:         max,
+	}
+}
+
+// acquire records a new connection from ip, and returns false if it
+// already has the maximum number of connections open.
+func (l *connectionLimiter) acquire(ip string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.connections[ip] >= l.max {
+		return false
+	}
+
+	l.connections[ip]++
+	return true
+}
+
+// release records that a connection from ip has closed.
+func (l *connectionLimiter) release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.connections[ip]--
+	if l.connections[ip] <= 0 {
+		delete(l.connections, ip)
+	}
+}
+
+// passwordFailures is the record of wrong passwords from an IP address.
+type passwordFailures struct {
+	count int
+	last  time.Time
+}
+
+// passwordLimiter locks out the IP addresses that tried too many wrong
+// room passwords, across every room. It is used from the goroutines of
+// the rooms.
+type passwordLimiter struct {
+	mutex    sync.Mutex
+	failures map[string]*passwordFailures
+	max      int
+	lockout  time.Duration
+}
+
+func newPasswordLimiter(max int, lockout time.Duration) *passwordLimiter {
+	return &passwordLimiter{
+		failures: make(map[string]*passwordFailures),
+		max:      max,
+		lockout:  lockout,
+	}
+}
+
+// locked returns whether ip is locked out. The lockout, and the count
+// of wrong passwords, end once there have been none for a while.
+func (l *passwordLimiter) locked(ip string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	failures, ok := l.failures[ip]
+	if !ok {
+		return false
+	}
+	if now.Sub(failures.last) >= l.lockout {
+		delete(l.failures, ip)
+		return false
+	}
+	return failures.count >= l.max
+}
+
+// fail records a wrong password from ip, and returns whether it is now
+// locked out.
+func (l *passwordLimiter) fail(ip string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	failures, ok := l.failures[ip]
+	if !ok || now.Sub(failures.last) >= l.lockout {
+		failures = &passwordFailures{}
+		l.failures[ip] = failures
+	}
+	failures.count++
+	failures.last = now
+	return failures.count >= l.max
+}
+
+// succeed forgets the wrong passwords from ip.
+func (l *passwordLimiter) succeed(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.failures, ip)
+}
+
+// prune forgets the wrong passwords that are too old to matter.
+func (l *passwordLimiter) prune(now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for ip, failures := range l.failures {
+		if now.Sub(failures.last) >= l.lockout {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// proxyList holds the networks of the reverse proxies in front of the
+// server, whose X-Forwarded-For header is trusted.
+type proxyList []*net.IPNet
+
+// newProxyList parses the trusted proxies, which have already been
+// validated with the settings.
+func newProxyList(proxies []string) proxyList {
+	var networks proxyList
+	for _, proxy := range proxies {
+		if network, err := config.ParseNetwork(proxy); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+func (p proxyList) trusts(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address a request came from. The
+// X-Forwarded-For header is only trusted when the request came through
+// one of the proxies, and then the client is the last address in it
+// that is not one of them, since anything before that can be forged.
+func (p proxyList) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !p.trusts(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !p.trusts(ip) {
+			break
+		}
+	}
+	return ip
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/config"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit config.RateLimit
+		// When each token is taken, after the bucket was created.
+		at   []time.Duration
+		want []bool
+	}{
+		{
+			name:  "burst",
+			limit: config.RateLimit{Rate: 1, Burst: 3},
+			at:    []time.Duration{0, 0, 0, 0},
+			want:  []bool{true, true, true, false},
+		},
+		{
+			name:  "refill",
+			limit: config.RateLimit{Rate: 2, Burst: 1},
+			at:    []time.Duration{0, 0, 250 * time.Millisecond, 500 * time.Millisecond},
+			want:  []bool{true, false, false, true},
+		},
+		{
+			name:  "refill stops at the burst",
+			limit: config.RateLimit{Rate: 10, Burst: 2},
+			at:    []time.Duration{time.Hour, time.Hour, time.Hour},
+			want:  []bool{true, true, false},
+		},
+		{
+			name:  "no refill",
+			limit: config.RateLimit{Rate: 0, Burst: 1},
+			at:    []time.Duration{0, time.Hour},
+			want:  []bool{true, false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTokenBucket(test.limit)
+			start := b.last
+			for i, at := range test.at {
+				if got := b.allow(start.Add(at)); got != test.want[i] {
+					t.Errorf("allow() #%d at %v = %v, want %v", i, at, got,
+						test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClientRateLimiter(t *testing.T) {
+	api.Init()
+	limits := config.RateLimitConfig{
+		Connection:    config.RateLimit{Rate: 0, Burst: 5},
+		DefaultAction: config.RateLimit{Rate: 0, Burst: 2},
+		Actions: map[string]config.RateLimit{
+			"send-chat": {Rate: 0, Burst: 1},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		actions []string
+		want    []bool
+	}{
+		{
+			name:    "configured action",
+			actions: []string{"send-chat", "send-chat"},
+			want:    []bool{true, false},
+		},
+		{
+			name:    "default action",
+			actions: []string{"start-game", "start-game", "start-game"},
+			want:    []bool{true, true, false},
+		},
+		{
+			name:    "actions are limited separately",
+			actions: []string{"send-chat", "start-game", "end-turn"},
+			want:    []bool{true, true, true},
+		},
+		{
+			name:    "unknown actions share a bucket",
+			actions: []string{"made-up", "also-made-up", "", "made-up"},
+			want:    []bool{true, true, false, false},
+		},
+		{
+			name:    "unknown actions do not use up known ones",
+			actions: []string{"made-up", "also-made-up", "start-game"},
+			want:    []bool{true, true, true},
+		},
+		{
+			name: "connection limit",
+			actions: []string{"send-chat", "start-game", "start-game",
+				"end-turn", "end-turn", "join-game"},
+			want: []bool{true, true, true, true, true, false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newClientRateLimiter(limits)
+			for i, action := range test.actions {
+				if got := l.allow(action); got != test.want[i] {
+					t.Errorf("allow(%q) #%d = %v, want %v", action, i, got,
+						test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClientRateLimiterBuckets(t *testing.T) {
+	api.Init()
+	l := newClientRateLimiter(config.RateLimitConfig{
+		Connection:    config.RateLimit{Rate: 0, Burst: 1000},
+		DefaultAction: config.RateLimit{Rate: 0, Burst: 1000},
+	})
+
+	for i := 0; i < 100; i++ {
+		l.allow(fmt.Sprintf("made-up-%d", i))
+	}
+	l.allow("send-chat")
+	l.allow("end-turn")
+
+	if len(l.actions) != 3 {
+		t.Errorf("allow() made %d buckets, want 3", len(l.actions))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := newProxyList([]string{"10.0.0.0/8", "192.168.1.1"})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "203.0.113.7:5000",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "forwarded header from an untrusted address",
+			remoteAddr: "203.0.113.7:5000",
+			forwarded:  "198.51.100.1",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "through a proxy",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  "198.51.100.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "through several proxies",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  "198.51.100.1, 192.168.1.1, 10.0.0.9",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "forged hops before the client",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  "1.2.3.4, 198.51.100.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "only proxies",
+			remoteAddr: "10.1.2.3:5000",
+			forwarded:  "10.0.0.8, 10.0.0.9",
+			want:       "10.0.0.8",
+		},
+		{
+			name:       "proxy without a header",
+			remoteAddr: "192.168.1.1:5000",
+			want:       "192.168.1.1",
+		},
+		{
+			name:       "single proxy address",
+			remoteAddr: "192.168.1.2:5000",
+			forwarded:  "198.51.100.1",
+			want:       "192.168.1.2",
+		},
+		{
+			name:       "IPv6",
+			remoteAddr: "[2001:db8::1]:5000",
+			forwarded:  "198.51.100.1",
+			want:       "2001:db8::1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &http.Request{
+				RemoteAddr: test.remoteAddr,
+				Header:     http.Header{},
+			}
+			if test.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+
+			if got := proxies.clientIP(r); got != test.want {
+				t.Errorf("clientIP() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPasswordLimiter(t *testing.T) {
+	const (
+		max     = 3
+		lockout = time.Minute
+	)
+
+	type step struct {
+		// One of "fail", "succeed", "prune", "locked" or "tracked",
+		// which is whether the failures of ip are still kept.
+		op   string
+		ip   string
+		at   time.Duration
+		want bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "locked after too many failures",
+			steps: []step{
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", time.Second, false},
+				{"locked", "1.1.1.1", time.Second, false},
+				{"fail", "1.1.1.1", 2 * time.Second, true},
+				{"locked", "1.1.1.1", 3 * time.Second, true},
+			},
+		},
+		{
+			name: "addresses are counted separately",
+			steps: []step{
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "2.2.2.2", 0, false},
+				{"locked", "2.2.2.2", 0, false},
+				{"fail", "1.1.1.1", 0, true},
+				{"locked", "2.2.2.2", 0, false},
+			},
+		},
+		{
+			name: "lockout ends",
+			steps: []step{
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", 0, true},
+				{"locked", "1.1.1.1", lockout - time.Second, true},
+				{"locked", "1.1.1.1", lockout, false},
+				{"fail", "1.1.1.1", lockout, false},
+			},
+		},
+		{
+			name: "old failures are forgotten",
+			steps: []step{
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", lockout, false},
+			},
+		},
+		{
+			name: "success forgets failures",
+			steps: []step{
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", 0, false},
+				{"succeed", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", 0, false},
+			},
+		},
+		{
+			name: "prune",
+			steps: []step{
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "1.1.1.1", 0, false},
+				{"fail", "2.2.2.2", 30 * time.Second, false},
+				{"fail", "2.2.2.2", 30 * time.Second, false},
+				{"prune", "", lockout, false},
+				{"tracked", "1.1.1.1", lockout, false},
+				{"tracked", "2.2.2.2", lockout, true},
+				{"fail", "2.2.2.2", lockout, true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newPasswordLimiter(max, lockout)
+			start := time.Now()
+			for i, s := range test.steps {
+				now := start.Add(s.at)
+
+				var got bool
+				switch s.op {
+				case "fail":
+					got = l.fail(s.ip, now)
+				case "succeed":
+					l.succeed(s.ip)
+				case "prune":
+					l.prune(now)
+				case "locked":
+					got = l.locked(s.ip, now)
+				case "tracked":
+					_, got = l.failures[s.ip]
+				}
+				if got != s.want {
+					t.Errorf("step %d: %s(%s) at %v = %v, want %v", i, s.op,
+						s.ip, s.at, got, s.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Package roomcode generates the codes that players type in to join a
+// room, with one of several schemes:
+//
+//	numeric       digits, e.g. "4821"
+//	alphanumeric  letters and digits that cannot be mistaken for each
+//	              other, e.g. "K7QX"
+//	words         adjectives followed by a noun, e.g. "PURPLE-OTTER"
+//
+// Codes are picked with a secure random source, so that they cannot be
+// predicted from the ones handed out before.
+package roomcode
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// Number of random codes tried before looking for a free code in
+	// order, which only happens once most of the codes are taken.
+	maxRandomAttempts = 32
+
+	// Maximum number of codes looked at in order, so that generating a
+	// code always finishes in a bounded time.
+	maxScannedCodes = 1 << 20
+
+	// Longest code that clients can send, as limited by the validation
+	// of requests.
+	maxCodeLength = 32
+)
+
+// ErrExhausted is returned when no free code could be found.
+var ErrExhausted = errors.New("no room codes are left")
+
+// unambiguousChars leaves out the characters that are easy to confuse,
+// such as 0 and O, or 1, I and L.
+const unambiguousChars = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// Scheme describes a kind of room code. Every code of a scheme has an
+// index, from 0 up to Size.
+type Scheme interface {
+	// Size returns the number of different codes.
+	Size() int64
+
+	// Code returns the code with the given index.
+	Code(index int64) string
+
+	// MaxLength returns the number of characters of the longest code.
+	MaxLength() int
+}
+
+// New returns the scheme with the given name, whose codes have the
+// given number of digits, characters or words.
+func New(name string, length int) (Scheme, error) {
+	var scheme Scheme
+	switch name {
+	case "numeric":
+		if length < 1 || length > 9 {
+			return nil, fmt.Errorf("numeric room codes must have 1 to 9 digits")
+		}
+		scheme = numericScheme{length}
+	case "alphanumeric":
+		if length < 1 || length > 12 {
+			return nil, fmt.Errorf(
+				"alphanumeric room codes must have 1 to 12 characters")
+		}
+		scheme = alphabetScheme{unambiguousChars, length}
+	case "words":
+		if length < 2 || length > 4 {
+			return nil, fmt.Errorf("word room codes must have 2 to 4 words")
+		}
+		scheme = wordScheme{length}
+	default:
+		return nil, fmt.Errorf("unknown room code scheme %q", name)
+	}
+
+	if scheme.MaxLength() > maxCodeLength {
+		return nil, fmt.Errorf("room codes cannot be longer than %d characters",
+			maxCodeLength)
+	}
+	return scheme, nil
+}
+
+// Generate returns a random code of the scheme that is not taken. After
+// a few random codes turn out to be taken, it looks for a free one in
+// order from a random starting point, and returns ErrExhausted if there
+// is none within a bounded number of codes.
+func Generate(scheme Scheme, taken func(code string) bool) (string, error) {
+	size := scheme.Size()
+	for i := 0; i < maxRandomAttempts; i++ {
+		code := scheme.Code(randomIndex(size))
+		if !taken(code) {
+			return code, nil
+		}
+	}
+
+	start := randomIndex(size)
+	for i := int64(0); i < size && i < maxScannedCodes; i++ {
+		code := scheme.Code((start + i) % size)
+		if !taken(code) {
+			return code, nil
+		}
+	}
+
+	return "", ErrExhausted
+}
+
+// Normalize returns the code that a player typed in the form it was
+// generated in. Codes are not case-sensitive.
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func randomIndex(size int64) int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(size))
+	if err != nil {
+		panic(err)
+	}
+	return n.Int64()
+}
+
+// numericScheme has codes of length digits, without a leading zero.
+type numericScheme struct {
+	length int
+}
+
+func (s numericScheme) Size() int64 {
+	return 9 * pow(10, s.length-1)
+}
+
+func (s numericScheme) Code(index int64) string {
+	return fmt.Sprint(pow(10, s.length-1) + index)
+}
+
+func (s numericScheme) MaxLength() int {
+	return s.length
+}
+
+// alphabetScheme has codes of length characters from an alphabet.
+type alphabetScheme struct {
+	alphabet string
+	length   int
+}
+
+func (s alphabetScheme) Size() int64 {
+	return pow(int64(len(s.alphabet)), s.length)
+}
+
+func (s alphabetScheme) Code(index int64) string {
+	code := make([]byte, s.length)
+	for i := len(code) - 1; i >= 0; i-- {
+		code[i] = s.alphabet[index%int64(len(s.alphabet))]
+		index /= int64(len(s.alphabet))
+	}
+	return string(code)
+}
+
+func (s alphabetScheme) MaxLength() int {
+	return s.length
+}
+
+// wordScheme has codes of length words: adjectives followed by a noun,
+// separated by hyphens.
+type wordScheme struct {
+	length int
+}
+
+func (s wordScheme) Size() int64 {
+	return pow(int64(len(adjectives)), s.length-1) * int64(len(nouns))
+}
+
+func (s wordScheme) Code(index int64) string {
+	words := make([]string, s.length)
+	words[s.length-1] = nouns[index%int64(len(nouns))]
+	index /= int64(len(nouns))
+	for i := s.length - 2; i >= 0; i-- {
+		words[i] = adjectives[index%int64(len(adjectives))]
+		index /= int64(len(adjectives))
+	}
+	return strings.Join(words, "-")
+}
+
+// MaxLength adds up the longest words, since any adjective can go with
+// any noun.
+func (s wordScheme) MaxLength() int {
+	return (s.length-1)*(longestWord(adjectives)+1) + longestWord(nouns)
+}
+
+func longestWord(words []string) int {
+	longest := 0
+	for _, word := range words {
+		if len(word) > longest {
+			longest = len(word)
+		}
+	}
+	return longest
+}
+
+func pow(base int64, exp int) int64 {
+	result := int64(1)
+	for i := 0; i < exp; i++ {
+		result *= base
+	}
+	return result
+}
@@ -0,0 +1,181 @@
+package roomcode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		scheme    string
+		length    int
+		wantErr   bool
+		wantSize  int64
+		wantFirst string
+		wantLast  string
+	}{
+		{scheme: "numeric", length: 1, wantSize: 9, wantFirst: "1", wantLast: "9"},
+		{scheme: "numeric", length: 4, wantSize: 9000, wantFirst: "1000", wantLast: "9999"},
+		{scheme: "numeric", length: 9, wantSize: 900000000, wantFirst: "100000000", wantLast: "999999999"},
+		{scheme: "numeric", length: 0, wantErr: true},
+		{scheme: "numeric", length: 10, wantErr: true},
+		{scheme: "alphanumeric", length: 1, wantSize: 31, wantFirst: "2", wantLast: "Z"},
+		{scheme: "alphanumeric", length: 3, wantSize: 31 * 31 * 31, wantFirst: "222", wantLast: "ZZZ"},
+		{scheme: "alphanumeric", length: 0, wantErr: true},
+		{scheme: "alphanumeric", length: 13, wantErr: true},
+		{
+			scheme:    "words",
+			length:    2,
+			wantSize:  int64(len(adjectives) * len(nouns)),
+			wantFirst: "AMBER-ANCHOR",
+			wantLast:  "ZESTY-ZEBRA",
+		},
+		{
+			scheme:    "words",
+			length:    3,
+			wantSize:  int64(len(adjectives) * len(adjectives) * len(nouns)),
+			wantFirst: "AMBER-AMBER-ANCHOR",
+			wantLast:  "ZESTY-ZESTY-ZEBRA",
+		},
+		{scheme: "words", length: 1, wantErr: true},
+		// Codes such as FRIENDLY-FRIENDLY-FRIENDLY-HEDGEHOG are too long
+		// to be joined.
+		{scheme: "words", length: 4, wantErr: true},
+		{scheme: "words", length: 5, wantErr: true},
+		{scheme: "emoji", length: 4, wantErr: true},
+	}
+
+	for _, test := range tests {
+		scheme, err := New(test.scheme, test.length)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("New(%q, %d) did not return an error", test.scheme,
+					test.length)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(%q, %d) = %v", test.scheme, test.length, err)
+			continue
+		}
+
+		if size := scheme.Size(); size != test.wantSize {
+			t.Errorf("New(%q, %d).Size() = %d, want %d", test.scheme,
+				test.length, size, test.wantSize)
+		}
+		if code := scheme.Code(0); code != test.wantFirst {
+			t.Errorf("New(%q, %d).Code(0) = %s, want %s", test.scheme,
+				test.length, code, test.wantFirst)
+		}
+		if code := scheme.Code(test.wantSize - 1); code != test.wantLast {
+			t.Errorf("New(%q, %d).Code(%d) = %s, want %s", test.scheme,
+				test.length, test.wantSize-1, code, test.wantLast)
+		}
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	tests := []struct {
+		scheme string
+		length int
+	}{
+		{"numeric", 3},
+		{"alphanumeric", 2},
+		{"words", 2},
+		{"words", 3},
+	}
+
+	for _, test := range tests {
+		scheme, err := New(test.scheme, test.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		longest := 0
+		for i := int64(0); i < scheme.Size(); i++ {
+			if code := scheme.Code(i); len(code) > longest {
+				longest = len(code)
+			}
+		}
+		if max := scheme.MaxLength(); max != longest {
+			t.Errorf("New(%q, %d).MaxLength() = %d, want %d", test.scheme,
+				test.length, max, longest)
+		}
+	}
+}
+
+func TestCodesAreUnambiguous(t *testing.T) {
+	scheme, err := New("alphanumeric", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := int64(0); i < scheme.Size(); i++ {
+		code := scheme.Code(i)
+		if strings.ContainsAny(code, "01ILO") {
+			t.Fatalf("Code(%d) = %s, which has an ambiguous character", i,
+				code)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	scheme, err := New("numeric", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		free    map[string]bool
+		wantErr error
+	}{
+		{
+			name: "every code free",
+		},
+		{
+			name: "one code free",
+			free: map[string]bool{"42": true},
+		},
+		{
+			name:    "no codes free",
+			free:    map[string]bool{},
+			wantErr: ErrExhausted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			taken := func(code string) bool {
+				return test.free != nil && !test.free[code]
+			}
+
+			code, err := Generate(scheme, taken)
+			if err != test.wantErr {
+				t.Fatalf("Generate() = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && taken(code) {
+				t.Errorf("Generate() = %s, which is taken", code)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"4821", "4821"},
+		{"k7qx", "K7QX"},
+		{"  K7qX\n", "K7QX"},
+		{"purple-Otter", "PURPLE-OTTER"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := Normalize(test.code); got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.code, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package roomcode
+
+// The words of word codes are short, and easy to spell and to say out
+// loud.
+
+var adjectives = []string{
+	"AMBER", "BLUE", "BOLD", "BRAVE", "BRIGHT", "BRISK", "CALM", "CLEVER",
+	"COZY", "CRISP", "CURLY", "DAINTY", "DARING", "EAGER", "FANCY", "FLUFFY",
+	"FRESH", "FRIENDLY", "FUNNY", "FUZZY", "GENTLE", "GIANT", "GLAD", "GOLDEN",
+	"GRAND", "GREEN", "HAPPY", "HASTY", "HUMBLE", "JOLLY", "JUMPY", "KIND",
+	"LAZY", "LIVELY", "LOYAL", "LUCKY", "MAGIC", "MELLOW", "MERRY", "MIGHTY",
+	"MISTY", "NIMBLE", "NOBLE", "ORANGE", "PLUCKY", "POLITE", "PROUD", "PURPLE",
+	"QUICK", "QUIET", "RAPID", "RED", "ROYAL", "RUSTY", "SHINY", "SILLY",
+	"SILVER", "SLEEPY", "SMOOTH", "SNOWY", "SPEEDY", "SUNNY", "SWIFT", "TIDY",
+	"VIVID", "WARM", "WILD", "WISE", "WITTY", "YELLOW", "ZANY", "ZESTY",
+}
+
+var nouns = []string{
+	"ANCHOR", "BADGER", "BEAVER", "BISON", "CAMEL", "CANDLE", "CASTLE", "COMET",
+	"CRANE", "DOLPHIN", "DRAGON", "EAGLE", "FALCON", "FERRET", "FOREST",
+	"FOX", "GECKO", "GIRAFFE", "GOOSE", "HARBOR", "HAWK", "HEDGEHOG", "HERON",
+	"IGLOO", "JAGUAR", "KETTLE", "KOALA", "LANTERN", "LEMUR", "LION", "LLAMA",
+	"LOBSTER", "MEADOW", "MOOSE", "NEWT", "OTTER", "OWL", "PANDA", "PARROT",
+	"PEBBLE", "PELICAN", "PENGUIN", "PIRATE", "PLANET", "PUFFIN", "RABBIT",
+	"RAVEN", "ROBIN", "ROCKET", "SALMON", "SEAL", "SPARROW", "SQUID", "SWAN",
+	"TIGER", "TOUCAN", "TURTLE", "VIOLIN", "WALRUS", "WHALE", "WIZARD",
+	"WOMBAT", "YAK", "ZEBRA",
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/logging"
+)
+
+const (
+	// How long to wait for the rooms to be saved and stopped on
+	// shutdown.
+	shutdownRoomTimeout = 5 * time.Second
+
+	// How long to wait for the clients to be sent their last messages
+	// on shutdown.
+	shutdownCloseTimeout = 5 * time.Second
+
+	// How long clients are told to wait before reconnecting, which
+	// should be about how long the server takes to come back up.
+	restartReconnectDelay = 5 * time.Second
+)
+
+// shutdown stops every room, after saving it if there is a store, then
+// tells every client that the server is restarting and closes its
+// connection. New connections are turned away from the moment it is
+// called.
+func (h *Hub) shutdown() {
+	h.mutex.Lock()
+	h.shuttingDown = true
+	h.mutex.Unlock()
+
+	h.stopAllRooms()
+	h.disconnectAll()
+}
+
+// isShuttingDown returns whether the hub has started shutting down.
+func (h *Hub) isShuttingDown() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.shuttingDown
+}
+
+// trackWriter counts a client's writePump, which shutdown waits for. It
+// returns false if the hub is shutting down and the client should be
+// turned away instead.
+func (h *Hub) trackWriter() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.shuttingDown {
+		return false
+	}
+
+	h.writers.Add(1)
+	return true
+}
+
+// addLiveClient records an open connection, so that it is disconnected
+// on shutdown.
+func (h *Hub) addLiveClient(client *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.liveClients[client] = true
+}
+
+// removeLiveClient records that a connection has been closed.
+func (h *Hub) removeLiveClient(client *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.liveClients, client)
+}
+
+// stopAllRooms saves every room to the store, if there is one, and then
+// stops its game and its goroutine, so that no timer or late action can
+// change it after it was saved. It waits until every room has stopped
+// or shutdownRoomTimeout has passed.
+func (h *Hub) stopAllRooms() {
+	rooms := h.getRooms()
+	stopped := make(chan struct{}, len(rooms))
+	numQueued := 0
+	for _, room := range rooms {
+		room := room
+		if room.Do(func() {
+			if h.store != nil {
+				h.saveRoom(room)
+			}
+			room.Game.Stop()
+			room.Close()
+			stopped <- struct{}{}
+		}) {
+			numQueued++
+		}
+	}
+
+	timeout := time.After(shutdownRoomTimeout)
+	for i := 0; i < numQueued; i++ {
+		select {
+		case <-stopped:
+		case <-timeout:
+			logging.Warn("Timed out stopping rooms", "stopped", i,
+				"rooms", numQueued)
+			return
+		}
+	}
+
+	logging.Info("Stopped rooms", "rooms", numQueued,
+		"saved", h.store != nil)
+}
+
+// disconnectAll tells every client that the server is restarting and
+// closes its connection with the service restart close code, waiting
+// until every connection is closed or shutdownCloseTimeout has passed.
+func (h *Hub) disconnectAll() {
+	// Clients that are not in a room, or not yet registered, are told
+	// too.
+	h.mutex.RLock()
+	clients := make([]*Client, 0, len(h.liveClients))
+	for client := range h.liveClients {
+		clients = append(clients, client)
+	}
+	h.mutex.RUnlock()
+
+	for _, client := range clients {
+		h.sendServerRestarting(client)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.Info("Disconnected clients", "clients", len(clients))
+	case <-time.After(shutdownCloseTimeout):
+		logging.Warn("Timed out disconnecting clients",
+			"clients", len(clients))
+	}
+}
+
+// sendServerRestarting tells a client that the server is restarting,
+// and closes its connection once the message has been written.
+func (h *Hub) sendServerRestarting(client *Client) {
+	output, err := json.Marshal(api.OutgoingMessage{
+		Event: api.Event[api.EventServerRestarting],
+		Body: api.ServerRestartingEvent{
+			Message:        "The server is restarting, reconnecting shortly.",
+			ReconnectAfter: restartReconnectDelay.Milliseconds(),
+		},
+	})
+	if err != nil {
+		logging.Error("Could not marshal message", "error", err)
+	} else {
+		client.trySend(output)
+	}
+
+	client.closeSendWith(websocket.CloseServiceRestart, "Server restarting")
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sndurkin/game-night-in/logging"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// restoreRooms loads all the rooms from the store. It must be called
+// before the hub starts running.
+func (h *Hub) restoreRooms() {
+	if h.store == nil {
+		return
+	}
+
+	snapshots, err := h.store.LoadAll()
+	if err != nil {
+		logging.Error("Could not load room snapshots", "error", err)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, snapshot := range snapshots {
+		room, err := h.restoreRoom(snapshot)
+		if err != nil {
+			logging.Warn("Could not restore room", "room", snapshot.RoomCode,
+				"error", err)
+			continue
+		}
+
+		h.rooms[room.RoomCode] = room
+		if room.CreatorIP != "" {
+			h.roomCreators[room.RoomCode] = room.CreatorIP
+		}
+		go room.Run()
+		h.scheduleOwnerHandoff(room)
+		room.Do(func() {
+			h.updateLobby(room)
+		})
+	}
+
+	logging.Info("Restored rooms", "rooms", len(h.rooms))
+}
+
+func (h *Hub) restoreRoom(
+	snapshot *models.RoomSnapshot,
+) (*models.GameRoom, error) {
+	def, ok := models.LookupGame(snapshot.GameType)
+	if !ok {
+		return nil, fmt.Errorf("unknown game type %s", snapshot.GameType)
+	}
+
+	room := models.NewGameRoom(snapshot.RoomCode, snapshot.GameType)
+	room.SetLastInteractionTime(snapshot.LastInteractionTime)
+	h.watchRoomFaults(room)
+	h.watchRoomChanges(room)
+
+	// Players stay disconnected until they reconnect with their name
+	// and room code.
+	now := time.Now()
+	for _, playerSnapshot := range snapshot.Players {
+		player := &models.Player{
+			Name:           playerSnapshot.Name,
+			Room:           room,
+			IsRoomOwner:    playerSnapshot.IsRoomOwner,
+			SessionToken:   playerSnapshot.SessionToken,
+			DisconnectedAt: now,
+		}
+		// The messages themselves are gone, so clients that resume will
+		// need a full resync.
+		player.Replay.Reset(playerSnapshot.LastSeq)
+		room.Players = append(room.Players, player)
+	}
+
+	room.ChatHistory = snapshot.ChatHistory
+	room.Password = snapshot.Password
+	room.Public = snapshot.Public
+	room.Title = snapshot.Title
+	room.MaxPlayers = snapshot.MaxPlayers
+	room.Bans = snapshot.Bans
+	room.CreatorIP = snapshot.CreatorIP
+
+	room.Game = def.NewGame(room, h.sendOutgoingMessages, h.sendErrorMessage)
+	if err := room.Game.Restore(snapshot.Game); err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// runRoomSnapshots periodically saves every room to the store.
+func (h *Hub) runRoomSnapshots() {
+	if h.store == nil {
+		return
+	}
+
+	for range time.Tick(h.cfg.Rooms.SnapshotInterval.Duration) {
+		for _, room := range h.getRooms() {
+			room := room
+			room.Do(func() {
+				h.saveRoom(room)
+			})
+		}
+	}
+}
+
+// saveRoom writes a snapshot of the room to the store.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) saveRoom(room *models.GameRoom) {
+	// Keep the last snapshot from before the game broke.
+	if room.Fault != nil {
+		return
+	}
+
+	gameSnapshot, err := room.Game.Snapshot()
+	if err != nil {
+		room.Logger().Error("Could not snapshot room", "error", err)
+		return
+	}
+
+	players := make([]models.PlayerSnapshot, 0, len(room.Players))
+	for _, player := range room.Players {
+		players = append(players, models.PlayerSnapshot{
+			Name:         player.Name,
+			IsRoomOwner:  player.IsRoomOwner,
+			SessionToken: player.SessionToken,
+			LastSeq:      player.Replay.LastSeq(),
+		})
+	}
+
+	err = h.store.Save(&models.RoomSnapshot{
+		RoomCode:            room.RoomCode,
+		GameType:            room.GameType,
+		LastInteractionTime: room.LastInteractionTime(),
+		Players:             players,
+		ChatHistory:         room.ChatHistory,
+		Password:            room.Password,
+		Public:              room.Public,
+		Title:               room.Title,
+		MaxPlayers:          room.MaxPlayers,
+		Bans:                room.Bans,
+		CreatorIP:           room.CreatorIP,
+		Game:                gameSnapshot,
+	})
+	if err != nil {
+		room.Logger().Error("Could not save room", "error", err)
+	}
+}
+
+// closeRoom stops a room that has already been removed from the hub
+// and deletes its snapshot. Anything queued on the room before this
+// call still runs first.
+func (h *Hub) closeRoom(room *models.GameRoom) {
+	room.Do(func() {
+		if h.store != nil {
+			if err := h.store.Delete(room.RoomCode); err != nil {
+				room.Logger().Warn("Could not delete room snapshot",
+					"error", err)
+			}
+		}
+
+		room.Game.Stop()
+		room.Close()
+	})
+}
+
+// getRooms returns all the rooms currently in the hub.
+func (h *Hub) getRooms() []*models.GameRoom {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	rooms := make([]*models.GameRoom, 0, len(h.rooms))
+	for _, room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/models"
+	"github.com/sndurkin/game-night-in/store"
+)
+
+func TestRoomSnapshotRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		req  api.CreateGameRequest
+	}{
+		{
+			name: "fishbowl",
+			req:  api.CreateGameRequest{GameType: "fishbowl", Name: "Ada"},
+		},
+		{
+			name: "codenames with every room setting",
+			req: api.CreateGameRequest{
+				GameType:   "codenames",
+				Name:       "Ada",
+				Password:   "secret",
+				Public:     true,
+				Title:      "Friday night",
+				MaxPlayers: 4,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "snapshots")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			fileStore, err := store.NewFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := newTestHub()
+			h.store = fileStore
+			room := createTestRoom(t, h, newTestClient(t, h, "198.51.100.1"),
+				test.req)
+			joinTestRoom(t, h, newTestClient(t, h, "203.0.113.5"), room,
+				api.JoinGameRequest{Name: "Bob", Password: test.req.Password})
+
+			var (
+				players []models.PlayerSnapshot
+				game    json.RawMessage
+			)
+			inTestRoom(t, room, func() {
+				for _, player := range room.Players {
+					players = append(players, models.PlayerSnapshot{
+						Name:         player.Name,
+						IsRoomOwner:  player.IsRoomOwner,
+						SessionToken: player.SessionToken,
+						LastSeq:      player.Replay.LastSeq(),
+					})
+				}
+				game, _ = room.Game.Snapshot()
+				h.saveRoom(room)
+			})
+
+			// The server restarts.
+			restarted := newTestHub()
+			restarted.store = fileStore
+			restarted.restoreRooms()
+			restored := restarted.rooms[room.RoomCode]
+			if restored == nil {
+				t.Fatalf("room %s was not restored", room.RoomCode)
+			}
+			defer restored.Close()
+
+			if ip := restarted.roomCreators[room.RoomCode]; ip != "198.51.100.1" {
+				t.Errorf("room creator = %q, want 198.51.100.1", ip)
+			}
+
+			inTestRoom(t, restored, func() {
+				var restoredPlayers []models.PlayerSnapshot
+				for _, player := range restored.Players {
+					if player.IsConnected() {
+						t.Errorf("%s is connected before reconnecting",
+							player.Name)
+					}
+					restoredPlayers = append(restoredPlayers,
+						models.PlayerSnapshot{
+							Name:         player.Name,
+							IsRoomOwner:  player.IsRoomOwner,
+							SessionToken: player.SessionToken,
+							LastSeq:      player.Replay.LastSeq(),
+						})
+				}
+				if !reflect.DeepEqual(restoredPlayers, players) {
+					t.Errorf("restored players %+v, want %+v",
+						restoredPlayers, players)
+				}
+
+				restoredGame, _ := restored.Game.Snapshot()
+				if !bytes.Equal(restoredGame, game) {
+					t.Errorf("restored game %s, want %s", restoredGame, game)
+				}
+
+				if (restored.Password != nil) != (test.req.Password != "") ||
+					restored.Password != nil &&
+						!restored.Password.Matches(test.req.Password) {
+					t.Errorf("restored password does not match %q",
+						test.req.Password)
+				}
+				if restored.Public != test.req.Public ||
+					restored.Title != room.Title ||
+					restored.MaxPlayers != test.req.MaxPlayers {
+					t.Errorf("restored settings public=%v title=%q "+
+						"maxPlayers=%d, want %v %q %d", restored.Public,
+						restored.Title, restored.MaxPlayers, test.req.Public,
+						room.Title, test.req.MaxPlayers)
+				}
+			})
+
+			// Bob takes back his seat, and his messages carry on from
+			// where they were.
+			bob := newTestClient(t, restarted, "203.0.113.5")
+			restarted.joinGame(bob, "", api.JoinGameRequest{
+				RoomCode:     room.RoomCode,
+				Name:         "Bob",
+				SessionToken: players[1].SessionToken,
+			})
+			inTestRoom(t, restored, func() {})
+
+			messages := takeMessages(t, bob)
+			if len(messages) == 0 {
+				t.Fatal("Bob was not sent the room after rejoining")
+			}
+			for _, msg := range messages {
+				if msg.ErrorCode != "" {
+					t.Errorf("Bob was sent error %s: %s", msg.ErrorCode,
+						msg.Error)
+				}
+				if msg.Seq != 0 && msg.Seq <= players[1].LastSeq {
+					t.Errorf("Bob was sent %s numbered %d, which he already "+
+						"had", msg.Event, msg.Seq)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sndurkin/game-night-in/logging"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+const snapshotExt = ".json"
+
+// FileStore persists room snapshots as one JSON file per room in
+// a local directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore, creating its directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{
+		dir: dir,
+	}, nil
+}
+
+// Save writes the snapshot of a room, replacing any previous one.
+func (s *FileStore) Save(snapshot *models.RoomSnapshot) error {
+	path, err := s.path(snapshot.RoomCode)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a crash mid-write never
+	// leaves a truncated snapshot behind.
+	tmpFile, err := ioutil.TempFile(s.dir, snapshot.RoomCode+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// Delete removes the snapshot of a room, if there is one.
+func (s *FileStore) Delete(roomCode string) error {
+	path, err := s.path(roomCode)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// LoadAll reads every snapshot in the store. Snapshots that cannot be
+// read are logged and skipped.
+func (s *FileStore) LoadAll() ([]*models.RoomSnapshot, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []*models.RoomSnapshot{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != snapshotExt {
+			continue
+		}
+
+		path := filepath.Join(s.dir, file.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			logging.Warn("Could not read room snapshot", "path", path,
+				"error", err)
+			continue
+		}
+
+		var snapshot models.RoomSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			logging.Warn("Could not parse room snapshot", "path", path,
+				"error", err)
+			continue
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+
+	return snapshots, nil
+}
+
+func (s *FileStore) path(roomCode string) (string, error) {
+	if roomCode == "" || strings.ContainsAny(roomCode, `/\.`) {
+		return "", fmt.Errorf("invalid room code for snapshot: %q", roomCode)
+	}
+
+	return filepath.Join(s.dir, roomCode+snapshotExt), nil
+}
@@ -1,6 +1,10 @@
 package util
 
-import "math/rand"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand"
+)
 
 func StringInSlice(arr []string, val string) bool {
 	for _, s := range arr {
@@ -29,5 +33,16 @@ func GetRandomNumberInRange(min, max int) int {
 		return min
 	}
 
-	return min + rand.Intn(max-min)
+	return min + mathrand.Intn(max-min)
+}
+
+// GenerateToken returns a random hex string that is infeasible to
+// guess, for use as a secret.
+func GenerateToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// roomCapacity returns the most players the room lets in, or 0 if there
+// is no limit. The owner can lower the limit of the game, but not raise
+// it.
+//
+// This function must be called from the room's goroutine.
+func roomCapacity(room *models.GameRoom) int {
+	_, max := room.Game.PlayerLimits()
+	if room.MaxPlayers > 0 && (max == 0 || room.MaxPlayers < max) {
+		return room.MaxPlayers
+	}
+	return max
+}
+
+// roomIsFull returns whether every seat in the room is taken.
+//
+// This function must be called from the room's goroutine.
+func roomIsFull(room *models.GameRoom) bool {
+	capacity := roomCapacity(room)
+	return capacity > 0 && len(room.Players) >= capacity
+}
+
+// checkMaxPlayers returns an error if the game cannot be played with
+// the most players the owner asked for.
+func checkMaxPlayers(game models.Game, maxPlayers int) error {
+	if maxPlayers == 0 {
+		return nil
+	}
+
+	min, max := game.PlayerLimits()
+	if maxPlayers < min {
+		return models.NewError(api.ErrorInvalidRequest,
+			fmt.Sprintf("This game needs at least %d players.", min))
+	}
+	if max > 0 && maxPlayers > max {
+		return models.NewError(api.ErrorInvalidRequest,
+			fmt.Sprintf("This game takes at most %d players.", max))
+	}
+	return nil
+}
+
+// checkLeavable returns an error if the player cannot give up their
+// seat in the room now. The games cannot carry on with fewer players,
+// so seats are only given up before the game starts. Spectators and
+// waiting players can always leave.
+//
+// This function must be called from the room's goroutine.
+func checkLeavable(room *models.GameRoom, player *models.Player) error {
+	if player.Room != room || player.IsSpectator ||
+		room.Game.State() == "waiting-room" {
+		return nil
+	}
+	return models.NewError(api.ErrorInvalidState,
+		"Players cannot leave or be removed while the game is in progress.")
+}
+
+// waitingPlayerIdx returns the index of the player with the given name
+// on the waitlist, or -1.
+//
+// This function must be called from the room's goroutine.
+func waitingPlayerIdx(room *models.GameRoom, name string) int {
+	for idx, waiting := range room.Waitlist {
+		if waiting.Player.Name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// waitingPlayers returns the players on the waitlist of the room.
+//
+// This function must be called from the room's goroutine.
+func waitingPlayers(room *models.GameRoom) []*models.Player {
+	players := make([]*models.Player, 0, len(room.Waitlist))
+	for _, waiting := range room.Waitlist {
+		players = append(players, waiting.Player)
+	}
+	return players
+}
+
+// rejectIfWaiting lets the player know, and returns true, if they are
+// still waiting for a seat in the room and so cannot play.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) rejectIfWaiting(
+	room *models.GameRoom,
+	player *models.Player,
+) bool {
+	if player.Room == room {
+		return false
+	}
+
+	h.sendErrorMessage(&models.ErrorMessageRequest{
+		Player: player,
+		Error:  "You are still waiting for a seat in this game.",
+		Code:   api.ErrorNotInRoom,
+	})
+	return true
+}
+
+// addToWaitlist queues a new player for a seat in the room. Its client
+// is bound to the room, so that it can leave the waitlist, but the
+// player only gets a room once seated.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) addToWaitlist(
+	room *models.GameRoom,
+	client *Client,
+	player *models.Player,
+	req api.JoinGameRequest,
+) {
+	player.Name = req.Name
+	room.Waitlist = append(room.Waitlist, &models.WaitingPlayer{
+		Player:  player,
+		Request: req,
+	})
+	room.Logger().Info("Added player to the waitlist", "player", player.Name,
+		"position", len(room.Waitlist))
+
+	h.bindClient(client, player, room)
+	h.sendWaitlist(room)
+}
+
+// removeFromWaitlist takes a player off the waitlist of the room. It
+// returns false if they were not on it.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) removeFromWaitlist(
+	room *models.GameRoom,
+	player *models.Player,
+) bool {
+	for idx, waiting := range room.Waitlist {
+		if waiting.Player == player {
+			room.Waitlist = append(room.Waitlist[:idx],
+				room.Waitlist[idx+1:]...)
+			h.sendWaitlist(room)
+			return true
+		}
+	}
+	return false
+}
+
+// seatWaitingPlayers gives the free seats of the room to the players on
+// its waitlist, in order, while the game has not started.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) seatWaitingPlayers(room *models.GameRoom) {
+	if len(room.Waitlist) == 0 || room.Fault != nil ||
+		room.Game.State() != "waiting-room" {
+		return
+	}
+
+	seated := false
+	for len(room.Waitlist) > 0 && !roomIsFull(room) {
+		waiting := room.Waitlist[0]
+		room.Waitlist[0] = nil
+		room.Waitlist = room.Waitlist[1:]
+		seated = true
+
+		client, ok := waiting.Player.Client.(*Client)
+		if !ok {
+			continue
+		}
+
+		waiting.Player.Logger().Info("Seating player from the waitlist")
+		if !h.seatPlayer(room, client, waiting.Player, waiting.Request) {
+			// The game has already told the player why.
+			h.unbindClient(client)
+		}
+	}
+
+	if seated {
+		h.sendWaitlist(room)
+	}
+}
+
+// sendWaitlist lets everyone in the room know who is waiting for a
+// seat, and everyone waiting where they are in line.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) sendWaitlist(room *models.GameRoom) {
+	names := make([]string, 0, len(room.Waitlist))
+	for _, waiting := range room.Waitlist {
+		names = append(names, waiting.Player.Name)
+	}
+
+	var msg api.OutgoingMessage
+	msg.Event = api.Event[api.EventUpdatedWaitlist]
+	msg.Body = api.UpdatedWaitlistEvent{
+		Waiting:    names,
+		MaxPlayers: roomCapacity(room),
+	}
+	h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+		SecondaryMsg: &msg,
+		Room:         room,
+	})
+
+	// Waiting players are not in the room, so their messages are not
+	// numbered for replaying.
+	for idx, waiting := range room.Waitlist {
+		var positionMsg api.OutgoingMessage
+		positionMsg.Event = api.Event[api.EventUpdatedWaitlist]
+		positionMsg.RequestID = waiting.Player.RequestID
+		positionMsg.Body = api.UpdatedWaitlistEvent{
+			Waiting:    names,
+			Position:   idx + 1,
+			MaxPlayers: roomCapacity(room),
+		}
+		h.sendOutgoingMessages(&models.OutgoingMessageRequest{
+			PrimaryClient: waiting.Player.Client,
+			PrimaryMsg:    &positionMsg,
+		})
+	}
+}
+
+// This function must be called from the room's goroutine.
+func (h *Hub) setMaxPlayers(
+	player *models.Player,
+	req api.SetMaxPlayersRequest,
+) {
+	player.Logger().Info("Set max players request",
+		"maxPlayers", req.MaxPlayers)
+
+	room, err := h.performRoomChecks(player, true, false)
+	if err == nil {
+		err = checkMaxPlayers(room.Game, req.MaxPlayers)
+	}
+	if err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+
+	// The players already seated keep their seats. Any seats that were
+	// added are given out after this action.
+	room.MaxPlayers = req.MaxPlayers
+	h.sendWaitlist(room)
+}
+
+// leaveGame lets a player give up their seat, or their place on the
+// waitlist, without closing their connection. The owner of the room
+// hands it to the next player.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) leaveGame(
+	room *models.GameRoom,
+	client *Client,
+	player *models.Player,
+) {
+	player.Logger().Info("Leave game request")
+
+	if h.removeFromWaitlist(room, player) {
+		h.unbindClient(client)
+		return
+	}
+
+	if player.IsSpectator {
+		h.removeSpectator(room, player)
+		h.unbindClient(client)
+		room.Game.UpdatePlayers()
+		return
+	}
+
+	if err := h.giveUpSeat(room, player); err != nil {
+		h.sendErrorMessage(&models.ErrorMessageRequest{
+			Player: player,
+			Error:  err.Error(),
+			Code:   models.ErrorCodeOf(err),
+		})
+		return
+	}
+	h.unbindClient(client)
+}
+
+// moveOutOfRoom takes a player out of their room when their client goes
+// on to create or join another game, so that the room stops sending it
+// messages. They give up their seat if the game lets them leave, and
+// otherwise keep it as if they had lost their connection, so that they
+// can take it back with their session token.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) moveOutOfRoom(
+	room *models.GameRoom,
+	client *Client,
+	player *models.Player,
+) {
+	player.Logger().Info("Moving to another game")
+
+	h.unbindClient(client)
+	player.Client = nil
+	if h.removeFromWaitlist(room, player) {
+		return
+	}
+	if player.IsSpectator {
+		h.removeSpectator(room, player)
+		room.Game.UpdatePlayers()
+		return
+	}
+	if h.giveUpSeat(room, player) != nil {
+		h.markDisconnected(room, player)
+	}
+}
+
+// giveUpSeat takes a player out of their seat in the room, and hands
+// the room to the next player if they owned it. It returns an error if
+// the game does not let them leave.
+//
+// This function must be called from the room's goroutine.
+func (h *Hub) giveUpSeat(room *models.GameRoom, player *models.Player) error {
+	for idx, p := range room.Players {
+		if p != player {
+			continue
+		}
+		if err := checkLeavable(room, player); err != nil {
+			return err
+		}
+
+		wasRoomOwner := player.IsRoomOwner
+		room.Players = append(room.Players[:idx], room.Players[idx+1:]...)
+		room.Game.Kick(player.Name)
+		if wasRoomOwner && len(room.Players) > 0 {
+			h.setRoomOwner(room, room.Players[0])
+		}
+		return nil
+	}
+	return nil
+}
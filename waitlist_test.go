@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sndurkin/game-night-in/api"
+	"github.com/sndurkin/game-night-in/models"
+)
+
+// playerNames returns the names of the players in the order given.
+func playerNames(players []*models.Player) []string {
+	names := []string{}
+	for _, player := range players {
+		names = append(names, player.Name)
+	}
+	return names
+}
+
+// boundTestRoom returns the room a test client is bound to, and has it
+// closed when the test ends.
+func boundTestRoom(t *testing.T, h *Hub, client *Client) *models.GameRoom {
+	t.Helper()
+
+	h.mutex.RLock()
+	room := client.room
+	h.mutex.RUnlock()
+	if room != nil {
+		t.Cleanup(room.Close)
+		inTestRoom(t, room, func() {})
+	}
+	return room
+}
+
+func TestWaitlistSeating(t *testing.T) {
+	tests := []struct {
+		name       string
+		sender     string
+		action     string
+		body       interface{}
+		wantSeated []string
+		wantWaits  []string
+		wantOwner  string
+	}{
+		{
+			name:       "players beyond the seats wait in line",
+			wantSeated: []string{"Ada", "Bob", "Cy", "Dan"},
+			wantWaits:  []string{"Eve", "Fay"},
+			wantOwner:  "Ada",
+		},
+		{
+			name:       "a seat given up goes to the first in line",
+			sender:     "Bob",
+			action:     "leave-game",
+			body:       api.LeaveGameRequest{},
+			wantSeated: []string{"Ada", "Cy", "Dan", "Eve"},
+			wantWaits:  []string{"Fay"},
+			wantOwner:  "Ada",
+		},
+		{
+			name:       "the owner hands the room on when leaving",
+			sender:     "Ada",
+			action:     "leave-game",
+			body:       api.LeaveGameRequest{},
+			wantSeated: []string{"Bob", "Cy", "Dan", "Eve"},
+			wantWaits:  []string{"Fay"},
+			wantOwner:  "Bob",
+		},
+		{
+			name:       "a waiting player gives up their place",
+			sender:     "Eve",
+			action:     "leave-game",
+			body:       api.LeaveGameRequest{},
+			wantSeated: []string{"Ada", "Bob", "Cy", "Dan"},
+			wantWaits:  []string{"Fay"},
+			wantOwner:  "Ada",
+		},
+		{
+			name:       "the owner adds seats",
+			sender:     "Ada",
+			action:     "set-max-players",
+			body:       api.SetMaxPlayersRequest{MaxPlayers: 5},
+			wantSeated: []string{"Ada", "Bob", "Cy", "Dan", "Eve"},
+			wantWaits:  []string{"Fay"},
+			wantOwner:  "Ada",
+		},
+		{
+			name:       "the owner lifts the limit",
+			sender:     "Ada",
+			action:     "set-max-players",
+			body:       api.SetMaxPlayersRequest{},
+			wantSeated: []string{"Ada", "Bob", "Cy", "Dan", "Eve", "Fay"},
+			wantWaits:  []string{},
+			wantOwner:  "Ada",
+		},
+		{
+			name:   "a seated player creates another game",
+			sender: "Bob",
+			action: "create-game",
+			body: api.CreateGameRequest{
+				GameType: "fishbowl",
+				Name:     "Bob",
+			},
+			wantSeated: []string{"Ada", "Cy", "Dan", "Eve"},
+			wantWaits:  []string{"Fay"},
+			wantOwner:  "Ada",
+		},
+		{
+			name:   "the owner creates another game",
+			sender: "Ada",
+			action: "create-game",
+			body: api.CreateGameRequest{
+				GameType: "fishbowl",
+				Name:     "Ada",
+			},
+			wantSeated: []string{"Bob", "Cy", "Dan", "Eve"},
+			wantWaits:  []string{"Fay"},
+			wantOwner:  "Bob",
+		},
+		{
+			name:       "a seated player joins again under another name",
+			sender:     "Bob",
+			action:     "join-game",
+			body:       api.JoinGameRequest{Name: "Robert"},
+			wantSeated: []string{"Ada", "Cy", "Dan", "Eve"},
+			wantWaits:  []string{"Fay", "Robert"},
+			wantOwner:  "Ada",
+		},
+		{
+			name:   "a waiting player creates another game",
+			sender: "Eve",
+			action: "create-game",
+			body: api.CreateGameRequest{
+				GameType: "fishbowl",
+				Name:     "Eve",
+			},
+			wantSeated: []string{"Ada", "Bob", "Cy", "Dan"},
+			wantWaits:  []string{"Fay"},
+			wantOwner:  "Ada",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newTestHub()
+			clients := map[string]*Client{
+				"Ada": newTestClient(t, h, "192.0.2.1"),
+			}
+			room := createTestRoom(t, h, clients["Ada"], api.CreateGameRequest{
+				GameType:   "fishbowl",
+				Name:       "Ada",
+				MaxPlayers: 4,
+			})
+			for idx, name := range []string{"Bob", "Cy", "Dan", "Eve", "Fay"} {
+				clients[name] = newTestClient(t, h,
+					fmt.Sprintf("192.0.2.%d", idx+2))
+				joinTestRoom(t, h, clients[name], room,
+					api.JoinGameRequest{Name: name})
+			}
+
+			if test.action != "" {
+				sender := clients[test.sender]
+				if req, ok := test.body.(api.JoinGameRequest); ok {
+					req.RoomCode = room.RoomCode
+					test.body = req
+				}
+				sendTestMessage(t, h, sender, room, test.action, test.body)
+				if codes := takeErrorCodes(t, sender); len(codes) > 0 {
+					t.Fatalf("%s was sent errors %v", test.sender, codes)
+				}
+				if test.action == "create-game" {
+					if newRoom := boundTestRoom(t, h, sender); newRoom == room {
+						t.Errorf("%s is still bound to the old room", test.sender)
+					}
+				}
+			}
+
+			inTestRoom(t, room, func() {
+				if got := playerNames(room.Players); !reflect.DeepEqual(got,
+					test.wantSeated) {
+					t.Errorf("seated %v, want %v", got, test.wantSeated)
+				}
+				if got := playerNames(waitingPlayers(room)); !reflect.DeepEqual(
+					got, test.wantWaits) {
+					t.Errorf("waiting %v, want %v", got, test.wantWaits)
+				}
+				for _, player := range room.Players {
+					if player.IsRoomOwner != (player.Name == test.wantOwner) {
+						t.Errorf("%s owns the room = %v, want %v", player.Name,
+							player.IsRoomOwner, !player.IsRoomOwner)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestMoveOutOfGameInProgress(t *testing.T) {
+	h := newTestHub()
+	h.cfg.Rooms.OwnerHandoffDelay.Duration = time.Millisecond
+
+	ada := newTestClient(t, h, "192.0.2.1")
+	room := createTestRoom(t, h, ada, api.CreateGameRequest{
+		GameType: "codenames",
+		Name:     "Ada",
+	})
+	bob := newTestClient(t, h, "192.0.2.2")
+	joinTestRoom(t, h, bob, room, api.JoinGameRequest{Name: "Bob"})
+	for idx, name := range []string{"Cy", "Dan"} {
+		joinTestRoom(t, h, newTestClient(t, h, fmt.Sprintf("192.0.2.%d", idx+3)),
+			room, api.JoinGameRequest{Name: name})
+	}
+	sendTestMessage(t, h, ada, room, "start-game", api.StartGameRequest{})
+
+	var adaToken string
+	inTestRoom(t, room, func() {
+		if state := room.Game.State(); state == "waiting-room" {
+			t.Fatalf("The game did not start: %v", takeErrorCodes(t, ada))
+		}
+		adaPlayer, _ := h.getPlayerInRoom(room, "Ada")
+		adaToken = adaPlayer.SessionToken
+	})
+
+	// Ada cannot give up their seat in the middle of the game, so they
+	// keep it while away, and the room goes to someone else.
+	sendTestMessage(t, h, ada, room, "create-game", api.CreateGameRequest{
+		GameType: "fishbowl",
+		Name:     "Ada",
+	})
+	newRoom := boundTestRoom(t, h, ada)
+	if newRoom == nil || newRoom == room {
+		t.Fatal("Ada is not bound to the new room")
+	}
+	takeMessages(t, ada)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var owner string
+		inTestRoom(t, room, func() {
+			for _, player := range room.Players {
+				if player.IsRoomOwner {
+					owner = player.Name
+				}
+			}
+		})
+		if owner == "Bob" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("The room is owned by %q, want Bob", owner)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	inTestRoom(t, room, func() {
+		adaPlayer, _ := h.getPlayerInRoom(room, "Ada")
+		if adaPlayer == nil {
+			t.Fatal("Ada lost their seat")
+		}
+		if adaPlayer.IsConnected() || adaPlayer.Client != nil {
+			t.Error("Ada is still connected to the old room")
+		}
+	})
+
+	sendTestMessage(t, h, bob, room, "send-chat",
+		api.SendChatRequest{Message: "Where did Ada go?"})
+	if messages := takeMessages(t, ada); len(messages) > 0 {
+		t.Errorf("The old room sent Ada %d messages after leaving",
+			len(messages))
+	}
+
+	// Ada can still take the seat back, which takes them out of the new
+	// room.
+	sendTestMessage(t, h, ada, newRoom, "join-game", api.JoinGameRequest{
+		RoomCode:     room.RoomCode,
+		Name:         "Ada",
+		SessionToken: adaToken,
+	})
+	inTestRoom(t, room, func() {
+		adaPlayer, _ := h.getPlayerInRoom(room, "Ada")
+		if adaPlayer.Client != ada || !adaPlayer.IsConnected() {
+			t.Error("Ada did not take the seat back")
+		}
+	})
+	inTestRoom(t, newRoom, func() {
+		if len(newRoom.Players) != 0 {
+			t.Errorf("The new room still has players %v",
+				playerNames(newRoom.Players))
+		}
+	})
+}